@@ -4,14 +4,13 @@ import FontAwesome from "@expo/vector-icons/FontAwesome";
 import { Tabs } from "expo-router";
 import { View, Text } from "react-native";
 import { useAuth } from "@/context/AuthContext";
-import { BASE_URL } from "@/constants/api";
 
 function TabBarIcon(props: { name: React.ComponentProps<typeof FontAwesome>['name']; color: string; }) {
   return <FontAwesome size={28} style={{ marginBottom: -3 }} {...props} />;
 }
 
 export default function TabLayout() {
-  const { user } = useAuth();
+  const { user, authFetch } = useAuth();
   const [unreadNotificationsCount, setUnreadNotificationsCount] = useState(0);
   const [unreadMessagesCount, setUnreadMessagesCount] = useState(0);
   
@@ -21,7 +20,7 @@ export default function TabLayout() {
     
     const fetchUnreadNotificationsCount = async () => {
       try {
-        const response = await fetch(`${BASE_URL}/api/notifications/unread-count?username=${encodeURIComponent(user.username)}`);
+        const response = await authFetch("/api/notifications/unread-count");
         const data = await response.json();
         setUnreadNotificationsCount(data.count);
       } catch (error) {
@@ -34,7 +33,7 @@ export default function TabLayout() {
     const intervalId = setInterval(fetchUnreadNotificationsCount, 30000);
     
     return () => clearInterval(intervalId);
-  }, [user?.username]);
+  }, [user?.username, authFetch]);
 
   useEffect(() => {
     if(!user?.username) return;
@@ -42,11 +41,7 @@ export default function TabLayout() {
     const fetchUnreadMessagesCount = async () => {
       try {
         console.log(`Fetching unread messages count for ${user.username}`);
-        // Use the full URL for debugging
-        const url = `${BASE_URL}/api/messages/unread-count?username=${encodeURIComponent(user.username)}`;
-        console.log(`Full URL: ${url}`);
-        
-        const response = await fetch(url);
+        const response = await authFetch("/api/messages/unread-count");
         
         if (!response.ok) {
           const errorText = await response.text();
@@ -67,7 +62,7 @@ export default function TabLayout() {
     const intervalId = setInterval(fetchUnreadMessagesCount, 30000);
     
     return () => clearInterval(intervalId);
-  }, [user?.username]);
+  }, [user?.username, authFetch]);
   
   return (
     <Tabs
@@ -5,10 +5,9 @@ import { useRouter } from "expo-router";
 import Post, { PostProps } from "@/components/Post";
 import Header from "@/components/Header";
 import { useAuth } from "@/context/AuthContext";
-import { BASE_URL } from "@/constants/api";
 
 export default function HomeScreen() {
-  const { user } = useAuth();
+  const { user, authFetch } = useAuth();
   const router = useRouter();
   const [posts, setPosts] = useState<PostProps[]>([]);
   const [loading, setLoading] = useState<boolean>(false);
@@ -27,7 +26,7 @@ export default function HomeScreen() {
     if (!user?.username) return;
     setLoading(true);
     try {
-      const response = await fetch(`${BASE_URL}/api/feed?username=${encodeURIComponent(user.username)}`);
+      const response = await authFetch("/api/feed");
       const data = await response.json();
       const feedData = Array.isArray(data) ? data : [];
       setPosts(feedData);
@@ -36,7 +35,7 @@ export default function HomeScreen() {
     } finally {
       setLoading(false);
     }
-  }, [user?.username]);
+  }, [user?.username, authFetch]);
 
   useEffect(() => {
     fetchFeed();
@@ -6,7 +6,6 @@ import MessageItem from "@/components/MessageItem";
 import Header from "@/components/Header";
 import { useRouter } from "expo-router";
 import FontAwesome from "@expo/vector-icons/FontAwesome";
-import { BASE_URL } from "@/constants/api";
 
 type Participant = {
   username: string;
@@ -31,7 +30,7 @@ type ConversationPreview = {
 };
 
 export default function MessagesScreen() {
-  const { user } = useAuth();
+  const { user, authFetch } = useAuth();
   const router = useRouter();
   const [conversations, setConversations] = useState<ConversationPreview[]>([]);
   const [loading, setLoading] = useState(true);
@@ -42,7 +41,7 @@ export default function MessagesScreen() {
     
     try {
       console.log(`Fetching conversations for ${user.username}`);
-      const response = await fetch(`${BASE_URL}/api/conversations?username=${encodeURIComponent(user.username)}`);
+      const response = await authFetch("/api/conversations");
       
       if (!response.ok) {
         const errorText = await response.text();
@@ -59,7 +58,7 @@ export default function MessagesScreen() {
       setLoading(false);
       setRefreshing(false);
     }
-  }, [user?.username]);
+  }, [user?.username, authFetch]);
 
   useEffect(() => {
     fetchConversations();
@@ -4,10 +4,9 @@ import { View, Text, StyleSheet, FlatList, ActivityIndicator, Pressable, Refresh
 import { useAuth } from "@/context/AuthContext";
 import NotificationItem, { NotificationProps } from "@/components/NotificationItem";
 import Header from "@/components/Header";
-import { BASE_URL } from "@/constants/api";
 
 export default function NotificationsScreen() {
-  const { user } = useAuth();
+  const { user, authFetch } = useAuth();
   const [notifications, setNotifications] = useState<NotificationProps[]>([]);
   const [loading, setLoading] = useState(true);
 
@@ -16,7 +15,7 @@ export default function NotificationsScreen() {
     
     setLoading(true);
     try {
-      const response = await fetch(`${BASE_URL}/api/notifications?username=${encodeURIComponent(user.username)}`);
+      const response = await authFetch("/api/notifications");
       const data = await response.json();
       
       // Debug logging
@@ -31,11 +30,11 @@ export default function NotificationsScreen() {
     } finally {
       setLoading(false);
     }
-  }, [user?.username]);
+  }, [user?.username, authFetch]);
 
   const markAsRead = async (id: number) => {
     try {
-      await fetch(`${BASE_URL}/api/notifications/read?id=${id}`, {
+      await authFetch(`/api/notifications/read?id=${id}`, {
         method: 'PUT',
       });
       
@@ -56,7 +55,7 @@ export default function NotificationsScreen() {
     if (!user?.username) return;
     
     try {
-      await fetch(`${BASE_URL}/api/notifications/read-all?username=${encodeURIComponent(user.username)}`, {
+      await authFetch("/api/notifications/read-all", {
         method: 'PUT',
       });
       
@@ -5,42 +5,72 @@ import { useRouter } from "expo-router";
 import { useAuth } from "@/context/AuthContext";
 
 import Header from "@/components/Header";
-import { BASE_URL } from "@/constants/api";
 
 export default function LoginScreen() {
   const [email, setEmail] = useState("");
   const [password, setPassword] = useState("");
+  const [challengeToken, setChallengeToken] = useState<string | null>(null);
+  const [code, setCode] = useState("");
   const router = useRouter();
-  const { login } = useAuth();
+  const { login, verifyTwoFactor } = useAuth();
 
   const handleLogin = async () => {
     try {
-      const response = await fetch(`${BASE_URL}/api/login`, {
-        method: "POST",
-        headers: {
-          "Content-Type": "application/json",
-        },
-        body: JSON.stringify({
-          email,
-          password,
-        }),
-      });
-
-      const data = await response.json();
-
-      if (response.ok) {
-        await login(email, password);
-        router.replace("/(tabs)");
-      }
-      else {
-        Alert.alert("Login Error", data.error || "An error occurred during login.");
+      const result = await login(email, password);
+      if (result.twoFactorRequired) {
+        setChallengeToken(result.challengeToken);
+        return;
       }
+      router.replace("/(tabs)");
+    } catch (error) {
+      Alert.alert("Login Error", error instanceof Error ? error.message : "An error occurred. Please try again.");
+    }
+  };
+
+  const handleVerify = async () => {
+    if (!challengeToken) return;
+    try {
+      await verifyTwoFactor(challengeToken, code);
+      router.replace("/(tabs)");
     } catch (error) {
-      console.error("Login error: ", error);
-      Alert.alert("Login Error", "An error occurred. Please try again.");
+      Alert.alert("Login Error", error instanceof Error ? error.message : "An error occurred. Please try again.");
     }
   };
 
+  if (challengeToken) {
+    return (
+      <View style={styles.container}>
+        <Header />
+
+        <Text style={styles.title}>Verify</Text>
+
+        <TextInput
+          style={styles.input}
+          placeholder="Authenticator or recovery code"
+          placeholderTextColor="#161D2B"
+          value={code}
+          onChangeText={setCode}
+          autoCapitalize="none"
+          autoCorrect={false}
+        />
+
+        <Button title="Verify" onPress={handleVerify} />
+
+        <Text style={styles.loginText}>
+          <Text
+            style={styles.loginLink}
+            onPress={() => {
+              setChallengeToken(null);
+              setCode("");
+            }}
+          >
+            Back to login
+          </Text>
+        </Text>
+      </View>
+    );
+  }
+
   return (
     <View style={styles.container}>
       <Header />
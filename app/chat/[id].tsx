@@ -15,7 +15,6 @@ import {
 import { useLocalSearchParams, useRouter, Stack } from "expo-router";
 import { useAuth } from "@/context/AuthContext";
 import FontAwesome from "@expo/vector-icons/FontAwesome";
-import { BASE_URL } from "@/constants/api";
 
 type Message = {
   id: number;
@@ -33,7 +32,7 @@ type Participant = {
 };
 
 export default function ChatScreen() {
-  const { user } = useAuth();
+  const { user, authFetch } = useAuth();
   const { id } = useLocalSearchParams();
   const router = useRouter();
   const [messages, setMessages] = useState<Message[]>([]);
@@ -56,9 +55,7 @@ export default function ChatScreen() {
         setLoading(true);
       }
       
-      const response = await fetch(
-        `${BASE_URL}/api/messages?conversation_id=${conversationId}&username=${encodeURIComponent(user.username)}`
-      );
+      const response = await authFetch(`/api/messages?conversation_id=${conversationId}`);
       
       if (!response.ok) {
         console.error(`Failed to fetch messages: ${response.status}`);
@@ -102,8 +99,8 @@ export default function ChatScreen() {
         }
             
         if (otherUsername) {
-          const participantResponse = await fetch(
-            `${BASE_URL}/api/profile?username=${encodeURIComponent(String(otherUsername))}`
+          const participantResponse = await authFetch(
+            `/api/profile?username=${encodeURIComponent(String(otherUsername))}`
           );
           
           if (participantResponse.ok) {
@@ -127,14 +124,12 @@ export default function ChatScreen() {
         setLoading(false);
       }
     }
-  }, [user?.username, conversationId, participant, messages.length, loading]);
+  }, [user?.username, conversationId, participant, messages.length, loading, authFetch]);
 
   // Helper function to get the other participant in a conversation
   const getOtherParticipant = async (conversationId: number, username: string): Promise<string | null> => {
     try {
-      const response = await fetch(
-        `${BASE_URL}/api/conversations?username=${encodeURIComponent(username)}`
-      );
+      const response = await authFetch("/api/conversations");
       
       if (!response.ok) {
         console.error(`Failed to fetch conversations: ${response.status}`);
@@ -188,14 +183,13 @@ export default function ChatScreen() {
     setInputText("");
     
     try {
-      const response = await fetch(`${BASE_URL}/api/messages/send`, {
+      const response = await authFetch("/api/messages/send", {
         method: "POST",
         headers: {
           "Content-Type": "application/json",
         },
         body: JSON.stringify({
           conversation_id: conversationId,
-          sender: user.username,
           content: trimmedText,
         }),
       });
@@ -271,11 +265,7 @@ export default function ChatScreen() {
       <View style={styles.headerContainer}>
         {participant.profile_picture ? (
           <Image
-            source={{ 
-              uri: participant.profile_picture.startsWith('data:') 
-                ? participant.profile_picture 
-                : `data:image/jpeg;base64,${participant.profile_picture}` 
-            }}
+            source={{ uri: participant.profile_picture }}
             style={styles.avatarHeader}
           />
         ) : (
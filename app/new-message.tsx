@@ -13,7 +13,6 @@ import {
 import { Stack, useRouter } from 'expo-router';
 import { useAuth } from '@/context/AuthContext';
 import FontAwesome from '@expo/vector-icons/FontAwesome';
-import { BASE_URL } from '@/constants/api';
 
 type Follower = {
   username: string;
@@ -22,7 +21,7 @@ type Follower = {
 };
 
 export default function NewMessageScreen() {
-  const { user } = useAuth();
+  const { user, authFetch } = useAuth();
   const router = useRouter();
   const [followers, setFollowers] = useState<Follower[]>([]);
   const [filteredFollowers, setFilteredFollowers] = useState<Follower[]>([]);
@@ -38,7 +37,7 @@ export default function NewMessageScreen() {
     const fetchFollowers = async () => {
       try {
         console.log(`Fetching followers for ${user.username}`);
-        const response = await fetch(`${BASE_URL}/api/followers?username=${encodeURIComponent(user.username)}`);
+        const response = await authFetch(`/api/followers?username=${encodeURIComponent(user.username)}`);
         
         if (!response.ok) {
           const errorText = await response.text();
@@ -58,7 +57,7 @@ export default function NewMessageScreen() {
     };
 
     fetchFollowers();
-  }, [user?.username]);
+  }, [user?.username, authFetch]);
 
   useEffect(() => {
     if (searchTerm.trim() === '') {
@@ -82,13 +81,12 @@ export default function NewMessageScreen() {
     
     setSending(true);
     try {
-      const response = await fetch(`${BASE_URL}/api/conversations/create`, {
+      const response = await authFetch('/api/conversations/create', {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
         },
         body: JSON.stringify({
-          creator: user.username,
           recipient: selectedUser.username,
           message: message.trim(),
         }),
@@ -136,7 +134,7 @@ export default function NewMessageScreen() {
             <View style={styles.recipientInfo}>
               {selectedUser.profile_picture ? (
                 <Image
-                  source={{ uri: `data:image/jpeg;base64,${selectedUser.profile_picture}` }}
+                  source={{ uri: selectedUser.profile_picture }}
                   style={styles.avatar}
                 />
               ) : (
@@ -226,7 +224,7 @@ export default function NewMessageScreen() {
                 >
                   {item.profile_picture ? (
                     <Image
-                      source={{ uri: `data:image/jpeg;base64,${item.profile_picture}` }}
+                      source={{ uri: item.profile_picture }}
                       style={styles.followerAvatar}
                     />
                   ) : (
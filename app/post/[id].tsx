@@ -16,7 +16,6 @@ import { useLocalSearchParams, useRouter } from "expo-router";
 import { useAuth } from "@/context/AuthContext";
 import ProfileButton from "@/components/ProfileButton";
 import FontAwesome from "@expo/vector-icons/FontAwesome";
-import { BASE_URL } from "@/constants/api";
 
 type PostDetail = {
   id: number;
@@ -47,7 +46,7 @@ type ViewPostResponse = {
 export default function ViewPostScreen() {
   const { id } = useLocalSearchParams<{ id: string }>();
   const router = useRouter();
-  const { user } = useAuth();
+  const { user, authFetch } = useAuth();
   const [post, setPost] = useState<PostDetail | null>(null);
   const [comments, setComments] = useState<CommentDetail[]>([]);
   const [loading, setLoading] = useState<boolean>(true);
@@ -61,7 +60,7 @@ export default function ViewPostScreen() {
     const fetchPostDetails = async () => {
       try {
         setLoading(true);
-        const res = await fetch(`${BASE_URL}/api/posts/view?id=${encodeURIComponent(id)}`);
+        const res = await authFetch(`/api/posts/view?id=${encodeURIComponent(id)}`);
         if (!res.ok) throw new Error("Failed to fetch post");
         const data: ViewPostResponse = await res.json();
         setPost(data.post);
@@ -75,20 +74,17 @@ export default function ViewPostScreen() {
       }
     };
     fetchPostDetails();
-  }, [id]);
+  }, [id, authFetch]);
 
   const handleLike = async () => {
     if (!user || !post || likeLoading) return;
     
     setLikeLoading(true);
     try {
-      const response = await fetch(`${BASE_URL}/api/posts/like`, {
+      const response = await authFetch('/api/posts/like', {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
-        body: JSON.stringify({ 
-          post_id: post.id,
-          username: user.username 
-        })
+        body: JSON.stringify({ post_id: post.id })
       });
       
       if (response.ok) {
@@ -107,12 +103,11 @@ export default function ViewPostScreen() {
     if (!commentText.trim()) return;
     try {
       setPostingComment(true);
-      const res = await fetch(`${BASE_URL}/api/comments/create`, {
+      const res = await authFetch("/api/comments/create", {
         method: "POST",
         headers: { "Content-Type": "application/json" },
         body: JSON.stringify({
           post_id: post?.id,
-          username: user?.username,
           content: commentText,
         }),
       });
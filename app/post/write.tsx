@@ -11,10 +11,9 @@ import {
 } from "react-native";
 import { useRouter } from "expo-router";
 import { useAuth } from "@/context/AuthContext";
-import { BASE_URL } from "@/constants/api";
 
 export default function WritePostScreen() {
-  const { user } = useAuth();
+  const { authFetch } = useAuth();
   const router = useRouter();
   const [content, setContent] = useState("");
   const [loading, setLoading] = useState(false);
@@ -26,13 +25,10 @@ export default function WritePostScreen() {
     }
     try {
       setLoading(true);
-      const response = await fetch(`${BASE_URL}/api/posts/create`, {
+      const response = await authFetch("/api/posts/create", {
         method: "POST",
         headers: { "Content-Type": "application/json" },
-        body: JSON.stringify({
-          username: user?.username,
-          content,
-        }),
+        body: JSON.stringify({ content }),
       });
       if (!response.ok) throw new Error("Post creation failed");
       Alert.alert("Success", "Post created", [
@@ -4,7 +4,6 @@ import { SafeAreaView, View, Text, StyleSheet, Image, ActivityIndicator, FlatLis
 import { useLocalSearchParams, useRouter } from "expo-router";
 import Post, { PostProps } from "@/components/Post";
 import { useAuth } from "@/context/AuthContext";
-import { BASE_URL } from "@/constants/api";
 
 
 type ProfileData = {
@@ -33,7 +32,7 @@ type ProfileResponse = {
 const ProfileScreen = () => {
   const { username } = useLocalSearchParams<{ username: string }>();
   const router = useRouter();
-  const { user: loggedInUser, logout } = useAuth();
+  const { user: loggedInUser, logout, authFetch } = useAuth();
 
   const [profile, setProfile] = useState<ProfileData | null>(null);
   const [posts, setPosts] = useState<PostProps[]>([]);
@@ -58,9 +57,7 @@ const ProfileScreen = () => {
     if (!username) return;
     try {
       setLoading(true);
-      const res = await fetch(
-        `${BASE_URL}/api/profile?username=${encodeURIComponent(username)}`
-      );
+      const res = await authFetch(`/api/profile?username=${encodeURIComponent(username)}`);
       if (!res.ok) throw new Error("Failed to fetch profile");
       const data: ProfileResponse = await res.json();
       const postsData = Array.isArray(data.posts) ? data.posts : [];
@@ -81,23 +78,19 @@ const ProfileScreen = () => {
     } finally {
       setLoading(false);
     }
-  }, [username]);
+  }, [username, authFetch]);
 
   const fetchFollowStatus = useCallback(async () => {
     if (!loggedInUser || isOwnProfile) return;
     try {
-      const res = await fetch(
-        `${BASE_URL}/api/follow/status?follower=${encodeURIComponent(
-          loggedInUser.username
-        )}&following=${encodeURIComponent(username)}`
-      );
+      const res = await authFetch(`/api/follow/status?following=${encodeURIComponent(username)}`);
       if (!res.ok) throw new Error("Failed to fetch follow status");
       const data = await res.json();
       setIsFollowing(data.isFollowing);
     } catch (err) {
       console.error("Error fetching follow status:", err);
     }
-  }, [loggedInUser, isOwnProfile, username]);
+  }, [loggedInUser, isOwnProfile, username, authFetch]);
 
   useEffect(() => {
     fetchProfileData();
@@ -111,13 +104,10 @@ const ProfileScreen = () => {
     if (!loggedInUser || isOwnProfile) return;
     setFollowLoading(true);
     try {
-      const response = await fetch(`${BASE_URL}/api/follow/toggle`, {
+      const response = await authFetch("/api/follow/toggle", {
         method: "POST",
         headers: { "Content-Type": "application/json" },
-        body: JSON.stringify({
-          follower: loggedInUser.username,
-          following: username,
-        }),
+        body: JSON.stringify({ following: username }),
       });
       if (!response.ok) {
         throw new Error("Failed to toggle follow");
@@ -13,12 +13,11 @@ import {
 import { useLocalSearchParams, useRouter } from "expo-router";
 import { useAuth } from "@/context/AuthContext";
 import * as ImagePicker from "expo-image-picker";
-import { BASE_URL } from "@/constants/api";
 
 export default function EditProfileScreen() {
   const { username } = useLocalSearchParams<{ username: string }>();
   const router = useRouter();
-  const { user, updateUser } = useAuth();
+  const { user, updateUser, authFetch } = useAuth();
 
   const [displayName, setDisplayName] = useState("");
   const [profilePicture, setProfilePicture] = useState("");
@@ -105,13 +104,13 @@ export default function EditProfileScreen() {
   const handleSave = async () => {
     try {
       setLoading(true);
-      const response = await fetch(`${BASE_URL}/api/profile/update`, {
+      const response = await authFetch("/api/profile/update", {
         method: "POST",
         headers: { "Content-Type": "application/json" },
+        // Only a newly picked picture is sent; the current one is a URL
         body: JSON.stringify({
-          username,
           display_name: displayName,
-          profile_picture: profilePicture,
+          profile_picture: profilePicture.startsWith("data:") ? profilePicture : "",
         }),
       });
       if (!response.ok) {
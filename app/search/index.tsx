@@ -3,7 +3,7 @@ import React, { useState, useEffect } from "react";
 import { SafeAreaView, View, Text, TextInput, StyleSheet, FlatList, ActivityIndicator, Pressable } from "react-native";
 import { useRouter } from "expo-router";
 import ProfileButton from "@/components/ProfileButton";
-import { BASE_URL } from "@/constants/api";
+import { useAuth } from "@/context/AuthContext";
 
 type UserResult = {
   username: string;
@@ -14,6 +14,7 @@ type UserResult = {
 
 export default function SearchScreen() {
   const router = useRouter();
+  const { authFetch } = useAuth();
   const [query, setQuery] = useState("");
   const [results, setResults] = useState<UserResult[]>([]);
   const [loading, setLoading] = useState(false);
@@ -25,7 +26,7 @@ export default function SearchScreen() {
     }
     try {
       setLoading(true);
-      const response = await fetch(`${BASE_URL}/api/search/users?q=${encodeURIComponent(query)}`);
+      const response = await authFetch(`/api/search/users?q=${encodeURIComponent(query)}`);
       if (!response.ok) throw new Error("Search failed");
       const data: UserResult[] = await response.json();
       setResults(data);
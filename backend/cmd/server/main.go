@@ -7,7 +7,12 @@ import (
 	"os"
 
 	"github.com/BenH9999/CampusConnect/backend/internal/db"
+	"github.com/BenH9999/CampusConnect/backend/internal/jobs"
+	"github.com/BenH9999/CampusConnect/backend/internal/mailer"
+	"github.com/BenH9999/CampusConnect/backend/internal/oidc"
 	"github.com/BenH9999/CampusConnect/backend/internal/routes"
+	"github.com/BenH9999/CampusConnect/backend/internal/storage"
+	"github.com/BenH9999/CampusConnect/backend/internal/throttle"
 )
 
 func main() {
@@ -17,6 +22,21 @@ func main() {
 	// Initialize database tables and sample data
 	db.InitTables()
 
+	// Set up outgoing email
+	mailer.Init()
+
+	// Set up single sign-on, if configured
+	oidc.Init()
+
+	// Set up login attempt tracking
+	throttle.Init()
+
+	// Set up media storage
+	storage.Init()
+
+	// Start background jobs
+	jobs.Start()
+
 	// Set up the router
 	router := routes.SetupRouter()
 
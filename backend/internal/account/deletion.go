@@ -0,0 +1,71 @@
+package account
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/BenH9999/CampusConnect/backend/internal/config"
+	"github.com/BenH9999/CampusConnect/backend/internal/db"
+)
+
+var (
+	ErrDeletionAlreadyScheduled = errors.New("account deletion is already scheduled")
+	ErrDeletionNotScheduled     = errors.New("account deletion is not scheduled")
+)
+
+// ScheduleDeletion marks the account for deletion once the grace period has
+// passed. Until then the user can sign in and cancel.
+func ScheduleDeletion(username string) (time.Time, error) {
+	var scheduledFor time.Time
+	err := db.DB.QueryRow(`
+		UPDATE users SET deletion_scheduled_for = NOW() + make_interval(secs => $2)
+		WHERE username = $1 AND deletion_scheduled_for IS NULL
+		RETURNING deletion_scheduled_for
+	`, username, config.GetAccountDeletionGracePeriod().Seconds()).Scan(&scheduledFor)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return time.Time{}, ErrDeletionAlreadyScheduled
+		}
+		return time.Time{}, err
+	}
+	return scheduledFor, nil
+}
+
+// CancelDeletion clears a scheduled deletion
+func CancelDeletion(username string) error {
+	result, err := db.DB.Exec(`
+		UPDATE users SET deletion_scheduled_for = NULL
+		WHERE username = $1 AND deletion_scheduled_for IS NOT NULL
+	`, username)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrDeletionNotScheduled
+	}
+	return nil
+}
+
+// PurgeDueAccounts deletes every account whose grace period is over. The
+// foreign keys cascade the delete to everything the user owns.
+func PurgeDueAccounts() error {
+	rows, err := db.DB.Query(`
+		DELETE FROM users WHERE deletion_scheduled_for <= NOW()
+		RETURNING username
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			return err
+		}
+		log.Println("Deleted account", username)
+	}
+	return rows.Err()
+}
@@ -0,0 +1,434 @@
+package account
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BenH9999/CampusConnect/backend/internal/db"
+	"github.com/BenH9999/CampusConnect/backend/internal/storage"
+)
+
+type exportProfile struct {
+	Username        string     `json:"username"`
+	Email           string     `json:"email"`
+	DisplayName     string     `json:"display_name"`
+	Affiliation     string     `json:"affiliation"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+	TOTPEnabledAt   *time.Time `json:"two_factor_enabled_at,omitempty"`
+	SSOLinked       bool       `json:"sso_linked"`
+}
+
+type exportPost struct {
+	ID           int        `json:"id"`
+	Content      string     `json:"content"`
+	QuotedPostID *int       `json:"quoted_post_id,omitempty"`
+	Visibility   string     `json:"visibility"`
+	Published    bool       `json:"published"`
+	PublishAt    *time.Time `json:"publish_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+type exportComment struct {
+	ID        int       `json:"id"`
+	PostID    int       `json:"post_id"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// exportPostRef is a like or repost of a post
+type exportPostRef struct {
+	PostID    int       `json:"post_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type exportPollVote struct {
+	PostID    int       `json:"post_id"`
+	Option    string    `json:"option"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type exportFollow struct {
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type exportNotification struct {
+	ID        int       `json:"id"`
+	Type      string    `json:"type"`
+	From      string    `json:"from"`
+	PostID    *int      `json:"post_id,omitempty"`
+	CommentID *int      `json:"comment_id,omitempty"`
+	Message   string    `json:"message"`
+	Read      bool      `json:"read"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type exportAttachment struct {
+	ID        int       `json:"id"`
+	PostID    *int      `json:"post_id,omitempty"`
+	File      string    `json:"file"`
+	MimeType  string    `json:"mime_type"`
+	AltText   string    `json:"alt_text"`
+	CreatedAt time.Time `json:"created_at"`
+
+	key string
+}
+
+type exportMessage struct {
+	Sender    string    `json:"sender"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type exportConversation struct {
+	ID           int             `json:"id"`
+	Participants []string        `json:"participants"`
+	CreatedAt    time.Time       `json:"created_at"`
+	Messages     []exportMessage `json:"messages"`
+}
+
+// BuildArchive collects everything stored about the user into a ZIP of JSON
+// files, one per kind of data, plus their profile picture
+func BuildArchive(username string) ([]byte, error) {
+	var profile exportProfile
+	var picture []byte
+	err := db.DB.QueryRow(`
+		SELECT username, email, display_name, affiliation, created_at, updated_at,
+			email_verified_at, totp_enabled_at, oidc_subject IS NOT NULL, profile_picture
+		FROM users WHERE username = $1
+	`, username).Scan(&profile.Username, &profile.Email, &profile.DisplayName, &profile.Affiliation,
+		&profile.CreatedAt, &profile.UpdatedAt, &profile.EmailVerifiedAt, &profile.TOTPEnabledAt,
+		&profile.SSOLinked, &picture)
+	if err != nil {
+		return nil, err
+	}
+
+	posts, err := exportPosts(username)
+	if err != nil {
+		return nil, err
+	}
+	comments, err := exportComments(username)
+	if err != nil {
+		return nil, err
+	}
+	likes, err := exportPostRefs(`SELECT post_id, created_at FROM likes WHERE username = $1 ORDER BY created_at`, username)
+	if err != nil {
+		return nil, err
+	}
+	reposts, err := exportPostRefs(`SELECT post_id, created_at FROM reposts WHERE username = $1 ORDER BY created_at`, username)
+	if err != nil {
+		return nil, err
+	}
+	bookmarks, err := exportPostRefs(`SELECT post_id, created_at FROM bookmarks WHERE username = $1 ORDER BY created_at`, username)
+	if err != nil {
+		return nil, err
+	}
+	pollVotes, err := exportPollVotes(username)
+	if err != nil {
+		return nil, err
+	}
+	following, err := exportFollows(`SELECT following, created_at FROM follows WHERE follower = $1 ORDER BY created_at`, username)
+	if err != nil {
+		return nil, err
+	}
+	followers, err := exportFollows(`SELECT follower, created_at FROM follows WHERE following = $1 ORDER BY created_at`, username)
+	if err != nil {
+		return nil, err
+	}
+	notifications, err := exportNotifications(username)
+	if err != nil {
+		return nil, err
+	}
+	conversations, err := exportConversations(username)
+	if err != nil {
+		return nil, err
+	}
+	attachments, err := exportAttachments(username)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []struct {
+		name string
+		data any
+	}{
+		{"profile.json", profile},
+		{"posts.json", posts},
+		{"comments.json", comments},
+		{"likes.json", likes},
+		{"reposts.json", reposts},
+		{"bookmarks.json", bookmarks},
+		{"poll_votes.json", pollVotes},
+		{"follows.json", map[string][]exportFollow{"following": following, "followers": followers}},
+		{"notifications.json", notifications},
+		{"conversations.json", conversations},
+		{"attachments.json", attachments},
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, file := range files {
+		f, err := zw.Create(file.name)
+		if err != nil {
+			return nil, err
+		}
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(file.data); err != nil {
+			return nil, err
+		}
+	}
+	if len(picture) > 0 {
+		ext := ".png"
+		if http.DetectContentType(picture) == "image/jpeg" {
+			ext = ".jpg"
+		}
+		f, err := zw.Create("profile_picture" + ext)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := f.Write(picture); err != nil {
+			return nil, err
+		}
+	}
+	for _, att := range attachments {
+		if err := copyBlob(zw, att.File, att.key); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func exportAttachments(username string) ([]exportAttachment, error) {
+	rows, err := db.DB.Query(`
+		SELECT id, post_id, storage_key, mime_type, alt_text, created_at
+		FROM attachments WHERE username = $1 ORDER BY created_at
+	`, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := []exportAttachment{}
+	for rows.Next() {
+		var a exportAttachment
+		if err := rows.Scan(&a.ID, &a.PostID, &a.key, &a.MimeType, &a.AltText, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		a.File = "attachments/" + strconv.Itoa(a.ID) + fileExtensions[a.MimeType]
+		attachments = append(attachments, a)
+	}
+	return attachments, rows.Err()
+}
+
+var fileExtensions = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"application/pdf": ".pdf",
+}
+
+// copyBlob adds a stored file to the archive. A blob missing from storage is
+// skipped rather than failing the whole export.
+func copyBlob(zw *zip.Writer, name, key string) error {
+	body, err := storage.Default.Get(key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, body)
+	return err
+}
+
+func exportPosts(username string) ([]exportPost, error) {
+	rows, err := db.DB.Query(`SELECT id, content, quoted_post_id, visibility, published, publish_at, created_at FROM posts WHERE username = $1 ORDER BY created_at`, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []exportPost{}
+	for rows.Next() {
+		var p exportPost
+		if err := rows.Scan(&p.ID, &p.Content, &p.QuotedPostID, &p.Visibility, &p.Published, &p.PublishAt, &p.CreatedAt); err != nil {
+			return nil, err
+		}
+		posts = append(posts, p)
+	}
+	return posts, rows.Err()
+}
+
+func exportComments(username string) ([]exportComment, error) {
+	rows, err := db.DB.Query(`SELECT id, post_id, content, created_at FROM comments WHERE username = $1 ORDER BY created_at`, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []exportComment{}
+	for rows.Next() {
+		var c exportComment
+		if err := rows.Scan(&c.ID, &c.PostID, &c.Content, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		comments = append(comments, c)
+	}
+	return comments, rows.Err()
+}
+
+func exportPostRefs(query, username string) ([]exportPostRef, error) {
+	rows, err := db.DB.Query(query, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	refs := []exportPostRef{}
+	for rows.Next() {
+		var ref exportPostRef
+		if err := rows.Scan(&ref.PostID, &ref.CreatedAt); err != nil {
+			return nil, err
+		}
+		refs = append(refs, ref)
+	}
+	return refs, rows.Err()
+}
+
+func exportPollVotes(username string) ([]exportPollVote, error) {
+	rows, err := db.DB.Query(`
+		SELECT v.post_id, o.text, v.created_at
+		FROM poll_votes v
+		JOIN poll_options o ON o.id = v.option_id
+		WHERE v.username = $1
+		ORDER BY v.created_at, o.position
+	`, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	votes := []exportPollVote{}
+	for rows.Next() {
+		var v exportPollVote
+		if err := rows.Scan(&v.PostID, &v.Option, &v.CreatedAt); err != nil {
+			return nil, err
+		}
+		votes = append(votes, v)
+	}
+	return votes, rows.Err()
+}
+
+func exportFollows(query, username string) ([]exportFollow, error) {
+	rows, err := db.DB.Query(query, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	follows := []exportFollow{}
+	for rows.Next() {
+		var f exportFollow
+		if err := rows.Scan(&f.Username, &f.CreatedAt); err != nil {
+			return nil, err
+		}
+		follows = append(follows, f)
+	}
+	return follows, rows.Err()
+}
+
+func exportNotifications(username string) ([]exportNotification, error) {
+	rows, err := db.DB.Query(`
+		SELECT id, type, sender_name, post_id, comment_id, message, read, created_at
+		FROM notifications WHERE username = $1 ORDER BY created_at
+	`, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := []exportNotification{}
+	for rows.Next() {
+		var n exportNotification
+		if err := rows.Scan(&n.ID, &n.Type, &n.From, &n.PostID, &n.CommentID, &n.Message, &n.Read, &n.CreatedAt); err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+// exportConversations includes every message in the user's conversations,
+// not just their own, since the other side of a thread is part of their
+// record of it
+func exportConversations(username string) ([]exportConversation, error) {
+	rows, err := db.DB.Query(`
+		SELECT c.id, c.created_at,
+			(SELECT string_agg(p.username, ',' ORDER BY p.username) FROM conversation_participants p WHERE p.conversation_id = c.id)
+		FROM conversations c
+		JOIN conversation_participants cp ON cp.conversation_id = c.id
+		WHERE cp.username = $1
+		ORDER BY c.created_at
+	`, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	conversations := []exportConversation{}
+	for rows.Next() {
+		c := exportConversation{Messages: []exportMessage{}}
+		var participants string
+		if err := rows.Scan(&c.ID, &c.CreatedAt, &participants); err != nil {
+			return nil, err
+		}
+		c.Participants = strings.Split(participants, ",")
+		conversations = append(conversations, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for i := range conversations {
+		msgRows, err := db.DB.Query(`
+			SELECT sender, content, created_at FROM messages
+			WHERE conversation_id = $1 ORDER BY created_at
+		`, conversations[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		for msgRows.Next() {
+			var m exportMessage
+			if err := msgRows.Scan(&m.Sender, &m.Content, &m.CreatedAt); err != nil {
+				msgRows.Close()
+				return nil, err
+			}
+			conversations[i].Messages = append(conversations[i].Messages, m)
+		}
+		msgRows.Close()
+		if err := msgRows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return conversations, nil
+}
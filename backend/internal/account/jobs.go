@@ -0,0 +1,152 @@
+package account
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/BenH9999/CampusConnect/backend/internal/config"
+	"github.com/BenH9999/CampusConnect/backend/internal/db"
+	"github.com/BenH9999/CampusConnect/backend/internal/mailer"
+	"github.com/BenH9999/CampusConnect/backend/internal/models"
+)
+
+// staleExportAfter is how long an export can sit in processing before it is
+// assumed the server died while building it and is picked up again
+const staleExportAfter = 15 * time.Minute
+
+var (
+	ErrExportInProgress = errors.New("an export is already in progress")
+	ErrExportNotFound   = errors.New("export not found")
+)
+
+const exportColumns = `id, status, COALESCE(octet_length(archive), 0), created_at, completed_at, expires_at`
+
+func scanExport(row interface{ Scan(...any) error }) (models.DataExport, error) {
+	var e models.DataExport
+	err := row.Scan(&e.ID, &e.Status, &e.SizeBytes, &e.CreatedAt, &e.CompletedAt, &e.ExpiresAt)
+	if e.Status == models.ExportReady {
+		e.DownloadURL = "/api/account/export/download?id=" + strconv.Itoa(e.ID)
+	}
+	return e, err
+}
+
+// RequestExport queues a new export of the user's data. Only one export can
+// be waiting or building at a time.
+func RequestExport(username string) (models.DataExport, error) {
+	var pending bool
+	err := db.DB.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM data_exports WHERE username = $1 AND status IN ('pending', 'processing'))
+	`, username).Scan(&pending)
+	if err != nil {
+		return models.DataExport{}, err
+	}
+	if pending {
+		return models.DataExport{}, ErrExportInProgress
+	}
+
+	return scanExport(db.DB.QueryRow(`
+		INSERT INTO data_exports (username) VALUES ($1)
+		RETURNING `+exportColumns, username))
+}
+
+// ListExports returns the user's exports, newest first
+func ListExports(username string) ([]models.DataExport, error) {
+	rows, err := db.DB.Query(`
+		SELECT `+exportColumns+` FROM data_exports
+		WHERE username = $1 ORDER BY created_at DESC
+	`, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	exports := []models.DataExport{}
+	for rows.Next() {
+		e, err := scanExport(rows)
+		if err != nil {
+			return nil, err
+		}
+		exports = append(exports, e)
+	}
+	return exports, rows.Err()
+}
+
+// ExportArchive returns a finished archive belonging to the user
+func ExportArchive(username string, id int) ([]byte, time.Time, error) {
+	var archive []byte
+	var completedAt time.Time
+	err := db.DB.QueryRow(`
+		SELECT archive, completed_at FROM data_exports
+		WHERE id = $1 AND username = $2 AND status = 'ready' AND expires_at > NOW()
+	`, id, username).Scan(&archive, &completedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, time.Time{}, ErrExportNotFound
+	}
+	return archive, completedAt, err
+}
+
+// ProcessPendingExports builds every queued export and emails each user when
+// theirs is ready. It is safe to run from more than one server at once.
+func ProcessPendingExports() error {
+	for {
+		var id int
+		var username, email string
+		err := db.DB.QueryRow(`
+			UPDATE data_exports e SET status = 'processing', started_at = NOW()
+			FROM users u
+			WHERE e.id = (
+				SELECT id FROM data_exports
+				WHERE status = 'pending'
+					OR (status = 'processing' AND started_at < NOW() - make_interval(secs => $1))
+				ORDER BY created_at
+				LIMIT 1
+				FOR UPDATE SKIP LOCKED
+			) AND u.username = e.username
+			RETURNING e.id, e.username, u.email
+		`, staleExportAfter.Seconds()).Scan(&id, &username, &email)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		archive, err := BuildArchive(username)
+		if err != nil {
+			log.Printf("Error building data export %d for %s: %v", id, username, err)
+			if _, err := db.DB.Exec(`UPDATE data_exports SET status = 'failed', completed_at = NOW() WHERE id = $1`, id); err != nil {
+				return err
+			}
+			continue
+		}
+
+		_, err = db.DB.Exec(`
+			UPDATE data_exports
+			SET status = 'ready', archive = $2, completed_at = NOW(), expires_at = NOW() + make_interval(secs => $3)
+			WHERE id = $1
+		`, id, archive, config.GetDataExportTTL().Seconds())
+		if err != nil {
+			return err
+		}
+
+		err = mailer.Send(mailer.Message{
+			To:      email,
+			Subject: "Your CampusConnect data export is ready",
+			Body: "Hi " + username + ",\n\n" +
+				"The copy of your CampusConnect data you asked for is ready to download from the app. " +
+				"It will be available for " + strconv.Itoa(int(config.GetDataExportTTL().Hours()/24)) + " days.\n",
+		})
+		if err != nil {
+			log.Println("Error sending data export email:", err)
+		}
+	}
+}
+
+// PurgeExpiredExports drops archives past their download window
+func PurgeExpiredExports() error {
+	_, err := db.DB.Exec(`DELETE FROM data_exports WHERE expires_at < NOW() OR (status = 'failed' AND completed_at < NOW() - INTERVAL '7 days')`)
+	return err
+}
@@ -0,0 +1,121 @@
+package account
+
+import (
+	"database/sql"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/BenH9999/CampusConnect/backend/internal/config"
+	"github.com/BenH9999/CampusConnect/backend/internal/db"
+)
+
+var (
+	ErrUsernameTaken      = errors.New("username is already taken")
+	ErrUsernameReserved   = errors.New("username was recently released and can't be claimed yet")
+	ErrUsernameUnchanged  = errors.New("username is unchanged")
+	ErrConfiguredUsername = errors.New("username is listed in ADMIN_USERNAMES")
+)
+
+// ChangeUsername renames the user. Every table referencing users(username)
+// cascades the update, so the whole rename is the one UPDATE inside this
+// transaction. The old name redirects to the new one and stays reserved for
+// the user for USERNAME_RECLAIM_COOLDOWN.
+func ChangeUsername(current, newUsername string) error {
+	if current == newUsername {
+		return ErrUsernameUnchanged
+	}
+	// ADMIN_USERNAMES is matched by name, so a rename would drop the role
+	if slices.Contains(config.GetAdminUsernames(), current) {
+		return ErrConfiguredUsername
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Serialise renames that race for the same name
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext(LOWER($1)))`, newUsername); err != nil {
+		return err
+	}
+
+	var taken bool
+	err = tx.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM users WHERE LOWER(username) = LOWER($1) AND username <> $2)
+	`, newUsername, current).Scan(&taken)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrUsernameTaken
+	}
+
+	reserved, err := usernameReserved(tx, newUsername, current)
+	if err != nil {
+		return err
+	}
+	if reserved {
+		return ErrUsernameReserved
+	}
+
+	// Claiming a name ends any redirect from it, whether it was the user's
+	// own old name or someone else's whose reservation has lapsed
+	if _, err := tx.Exec(`DELETE FROM username_history WHERE LOWER(old_username) = LOWER($1)`, newUsername); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE users SET username = $1, updated_at = NOW() WHERE username = $2`, newUsername, current)
+	if err != nil {
+		return err
+	}
+
+	// A change of case alone doesn't release anything
+	if !strings.EqualFold(current, newUsername) {
+		_, err = tx.Exec(`
+			INSERT INTO username_history (old_username, username, reclaimable_at)
+			VALUES ($1, $2, NOW() + make_interval(secs => $3))
+		`, current, newUsername, config.GetUsernameReclaimCooldown().Seconds())
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// UsernameReserved reports whether the name was given up by another account
+// recently enough that it can't be claimed yet
+func UsernameReserved(username string) (bool, error) {
+	return usernameReserved(db.DB, username, "")
+}
+
+// ResolveUsername follows renames, returning the current name of the account
+// that used to be called username, or "" if there isn't one
+func ResolveUsername(username string) (string, error) {
+	var current string
+	err := db.DB.QueryRow(`
+		SELECT username FROM username_history WHERE LOWER(old_username) = LOWER($1)
+	`, username).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return current, err
+}
+
+// queryRower is satisfied by both *sql.DB and *sql.Tx
+type queryRower interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+func usernameReserved(q queryRower, username, exceptOwner string) (bool, error) {
+	var reserved bool
+	err := q.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1 FROM username_history
+			WHERE LOWER(old_username) = LOWER($1) AND reclaimable_at > NOW() AND username <> $2
+		)
+	`, username, exceptOwner).Scan(&reserved)
+	return reserved, err
+}
@@ -0,0 +1,9 @@
+// Package assets holds files embedded into the server binary
+package assets
+
+import _ "embed"
+
+// DefaultAvatar is the 400x400 PNG shown for users without a profile picture
+//
+//go:embed default_avatar.png
+var DefaultAvatar []byte
@@ -0,0 +1,31 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+)
+
+type contextKey struct{}
+
+type identity struct {
+	username  string
+	sessionID int64
+}
+
+// WithUser returns a copy of ctx carrying the authenticated user and session
+func WithUser(ctx context.Context, username string, sessionID int64) context.Context {
+	return context.WithValue(ctx, contextKey{}, identity{username: username, sessionID: sessionID})
+}
+
+// CurrentUser returns the authenticated username for the request, or "" if
+// the request did not pass through the auth middleware
+func CurrentUser(r *http.Request) string {
+	id, _ := r.Context().Value(contextKey{}).(identity)
+	return id.username
+}
+
+// CurrentSession returns the session ID the request's access token belongs to
+func CurrentSession(r *http.Request) int64 {
+	id, _ := r.Context().Value(contextKey{}).(identity)
+	return id.sessionID
+}
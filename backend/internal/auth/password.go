@@ -0,0 +1,172 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/BenH9999/CampusConnect/backend/internal/config"
+	"github.com/BenH9999/CampusConnect/backend/internal/db"
+)
+
+var (
+	ErrInvalidResetToken = errors.New("invalid or expired reset token")
+	ErrWrongPassword     = errors.New("current password is incorrect")
+)
+
+// HashPassword hashes a password for storage in users.password
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// CheckPassword reports whether password is the user's current password
+func CheckPassword(username, password string) (bool, error) {
+	var stored string
+	err := db.DB.QueryRow(`SELECT password FROM users WHERE username = $1`, username).Scan(&stored)
+	if err != nil {
+		return false, err
+	}
+	return bcrypt.CompareHashAndPassword([]byte(stored), []byte(password)) == nil, nil
+}
+
+// CreatePasswordReset issues a single-use reset token for the user. Only the
+// token's hash is stored.
+func CreatePasswordReset(username string) (string, error) {
+	token, err := RandomToken()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = db.DB.Exec(`
+		INSERT INTO password_resets (token_hash, username, expires_at)
+		VALUES ($1, $2, $3)
+	`, HashToken(token), username, time.Now().Add(config.GetPasswordResetTTL()))
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ResetPassword uses up a reset token to set a new password. Any other
+// outstanding reset tokens and every session for the user are revoked, since
+// a reset usually means the old password can't be trusted.
+func ResetPassword(token, newPassword string) (string, error) {
+	hash, err := HashPassword(newPassword)
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var username string
+	err = tx.QueryRow(`
+		UPDATE password_resets SET used_at = NOW()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING username
+	`, HashToken(token)).Scan(&username)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", ErrInvalidResetToken
+		}
+		return "", err
+	}
+
+	if err := setPassword(tx, username, hash); err != nil {
+		return "", err
+	}
+
+	_, err = tx.Exec(`UPDATE password_resets SET used_at = NOW() WHERE username = $1 AND used_at IS NULL`, username)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := revokeAllSessions(tx, username, 0); err != nil {
+		return "", err
+	}
+
+	return username, tx.Commit()
+}
+
+// ChangePassword sets a new password after checking the current one, and
+// signs out every session except keepSessionID
+func ChangePassword(username, currentPassword, newPassword string, keepSessionID int64) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var stored string
+	err = tx.QueryRow(`SELECT password FROM users WHERE username = $1 FOR UPDATE`, username).Scan(&stored)
+	if err != nil {
+		return err
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(stored), []byte(currentPassword)) != nil {
+		return ErrWrongPassword
+	}
+
+	hash, err := HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	if err := setPassword(tx, username, hash); err != nil {
+		return err
+	}
+
+	if _, err := revokeAllSessions(tx, username, keepSessionID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func setPassword(ex execer, username, hash string) error {
+	_, err := ex.Exec(`UPDATE users SET password = $1, updated_at = NOW() WHERE username = $2`, hash, username)
+	return err
+}
+
+// ResetCredentials replaces the user's password with a random one nobody
+// knows and removes everything else that could sign them in: 2FA, recovery
+// codes, outstanding reset tokens and every session, along with the
+// sessions' refresh tokens. It's used when someone else proves they own the
+// account's email before its registrant ever did.
+func ResetCredentials(tx *sql.Tx, username string) error {
+	secret, err := RandomToken()
+	if err != nil {
+		return err
+	}
+	hash, err := HashPassword(secret)
+	if err != nil {
+		return err
+	}
+	if err := setPassword(tx, username, hash); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = 0
+		WHERE username = $1
+	`, username)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM recovery_codes WHERE username = $1`, username); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`UPDATE password_resets SET used_at = NOW() WHERE username = $1 AND used_at IS NULL`, username)
+	if err != nil {
+		return err
+	}
+
+	_, err = revokeAllSessions(tx, username, 0)
+	return err
+}
@@ -0,0 +1,187 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/BenH9999/CampusConnect/backend/internal/config"
+	"github.com/BenH9999/CampusConnect/backend/internal/db"
+	"github.com/BenH9999/CampusConnect/backend/internal/models"
+)
+
+type Permission string
+
+const (
+	PermManageRoles        Permission = "manage_roles"
+	PermManageEmailDomains Permission = "manage_email_domains"
+	PermManageLockouts     Permission = "manage_lockouts"
+	PermModerateContent    Permission = "moderate_content"
+	PermPostAnnouncements  Permission = "post_announcements"
+)
+
+// rolePermissions is what each role adds on top of what every signed in
+// user can already do
+var rolePermissions = map[models.Role][]Permission{
+	models.RoleAdmin: {
+		PermManageRoles,
+		PermManageEmailDomains,
+		PermManageLockouts,
+		PermModerateContent,
+		PermPostAnnouncements,
+	},
+	models.RoleModerator: {PermModerateContent},
+	models.RoleStaff:     {PermPostAnnouncements},
+	models.RoleStudent:   {},
+}
+
+var (
+	ErrUnknownRole      = errors.New("unknown role")
+	ErrBaseRole         = errors.New("every account has the student role")
+	ErrConfiguredRole   = errors.New("role is granted by ADMIN_USERNAMES")
+	ErrRoleNotGranted   = errors.New("user does not have that role")
+	ErrRoleUserNotFound = errors.New("user not found")
+)
+
+// Roles returns every role the user holds. Every account is a student,
+// and users in ADMIN_USERNAMES are admins whatever the database says.
+func Roles(username string) ([]models.Role, error) {
+	roles := []models.Role{models.RoleStudent}
+	if username == "" {
+		return roles, nil
+	}
+	if slices.Contains(config.GetAdminUsernames(), username) {
+		roles = append(roles, models.RoleAdmin)
+	}
+
+	rows, err := db.DB.Query(`SELECT role FROM user_roles WHERE username = $1`, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var role models.Role
+		if err := rows.Scan(&role); err != nil {
+			return nil, err
+		}
+		if !slices.Contains(roles, role) {
+			roles = append(roles, role)
+		}
+	}
+	return roles, rows.Err()
+}
+
+// HasPermission reports whether any of the user's roles grants perm
+func HasPermission(username string, perm Permission) (bool, error) {
+	roles, err := Roles(username)
+	if err != nil {
+		return false, err
+	}
+	for _, role := range roles {
+		if slices.Contains(rolePermissions[role], perm) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Can reports whether the signed in user behind r has perm. Lookup errors
+// count as a refusal.
+func Can(r *http.Request, perm Permission) bool {
+	ok, err := HasPermission(CurrentUser(r), perm)
+	return err == nil && ok
+}
+
+// Permissions lists everything the user's roles allow, for clients that
+// want to hide actions the user can't take
+func Permissions(roles []models.Role) []Permission {
+	perms := []Permission{}
+	for _, role := range roles {
+		for _, perm := range rolePermissions[role] {
+			if !slices.Contains(perms, perm) {
+				perms = append(perms, perm)
+			}
+		}
+	}
+	return perms
+}
+
+// GrantRole gives the user a role. Granting a role they already hold is a no-op.
+func GrantRole(username string, role models.Role, grantedBy string) error {
+	if !role.Valid() {
+		return ErrUnknownRole
+	}
+	if role == models.RoleStudent {
+		return ErrBaseRole
+	}
+
+	result, err := db.DB.Exec(`
+		INSERT INTO user_roles (username, role, granted_by)
+		SELECT username, $2, $3 FROM users WHERE username = $1
+		ON CONFLICT (username, role) DO NOTHING
+	`, username, role, grantedBy)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		var exists bool
+		if err := db.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM users WHERE username = $1)`, username).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return ErrRoleUserNotFound
+		}
+	}
+	return nil
+}
+
+// RevokeRole takes a role away from the user
+func RevokeRole(username string, role models.Role) error {
+	if !role.Valid() {
+		return ErrUnknownRole
+	}
+	if role == models.RoleStudent {
+		return ErrBaseRole
+	}
+	if role == models.RoleAdmin && slices.Contains(config.GetAdminUsernames(), username) {
+		return ErrConfiguredRole
+	}
+
+	result, err := db.DB.Exec(`DELETE FROM user_roles WHERE username = $1 AND role = $2`, username, role)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrRoleNotGranted
+	}
+	return nil
+}
+
+// ListRoleGrants returns every role held beyond the student default,
+// including admins from ADMIN_USERNAMES
+func ListRoleGrants() ([]models.RoleGrant, error) {
+	grants := []models.RoleGrant{}
+	for _, username := range config.GetAdminUsernames() {
+		grants = append(grants, models.RoleGrant{Username: username, Role: models.RoleAdmin, Source: "config"})
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT username, role, COALESCE(granted_by, ''), granted_at
+		FROM user_roles
+		ORDER BY username, role
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		grant := models.RoleGrant{Source: "admin"}
+		if err := rows.Scan(&grant.Username, &grant.Role, &grant.GrantedBy, &grant.GrantedAt); err != nil {
+			return nil, err
+		}
+		grants = append(grants, grant)
+	}
+	return grants, rows.Err()
+}
@@ -0,0 +1,272 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/BenH9999/CampusConnect/backend/internal/config"
+	"github.com/BenH9999/CampusConnect/backend/internal/db"
+	"github.com/BenH9999/CampusConnect/backend/internal/models"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reused")
+)
+
+// SessionInfo describes the client a session was opened from
+type SessionInfo struct {
+	DeviceName string
+	IPAddress  string
+	UserAgent  string
+}
+
+// TokenPair is what a client receives after logging in or refreshing
+type TokenPair struct {
+	AccessToken      string
+	AccessExpiresAt  time.Time
+	RefreshToken     string
+	RefreshExpiresAt time.Time
+}
+
+// StartSession opens a new session for the user and issues its first token pair
+func StartSession(username string, info SessionInfo) (*TokenPair, error) {
+	refreshExpiresAt := time.Now().Add(config.GetRefreshTokenTTL())
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var sessionID int64
+	err = tx.QueryRow(`
+		INSERT INTO sessions (username, device_name, ip_address, user_agent, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`, username, info.DeviceName, info.IPAddress, info.UserAgent, refreshExpiresAt).Scan(&sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := insertRefreshToken(tx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return newTokenPair(username, sessionID, refreshToken, refreshExpiresAt)
+}
+
+// RefreshSession exchanges a refresh token for a new token pair. The presented
+// token is used up; presenting it again revokes the whole session, since that
+// means someone other than the legitimate client holds a copy.
+func RefreshSession(refreshToken, ipAddress string) (*TokenPair, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var sessionID int64
+	var username string
+	var usedAt, revokedAt sql.NullTime
+	var expiresAt time.Time
+	err = tx.QueryRow(`
+		SELECT s.id, s.username, rt.used_at, s.revoked_at, s.expires_at
+		FROM refresh_tokens rt
+		JOIN sessions s ON s.id = rt.session_id
+		WHERE rt.token_hash = $1
+		FOR UPDATE
+	`, HashToken(refreshToken)).Scan(&sessionID, &username, &usedAt, &revokedAt, &expiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	if revokedAt.Valid || time.Now().After(expiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if usedAt.Valid {
+		// Commit the revocation even though the refresh itself fails
+		if _, err := tx.Exec(`UPDATE sessions SET revoked_at = NOW() WHERE id = $1`, sessionID); err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		log.Printf("Refresh token reuse detected, revoked session %d for %s", sessionID, username)
+		return nil, ErrRefreshTokenReused
+	}
+
+	_, err = tx.Exec(`UPDATE refresh_tokens SET used_at = NOW() WHERE token_hash = $1`, HashToken(refreshToken))
+	if err != nil {
+		return nil, err
+	}
+
+	refreshExpiresAt := time.Now().Add(config.GetRefreshTokenTTL())
+	_, err = tx.Exec(`
+		UPDATE sessions
+		SET last_seen_at = NOW(), ip_address = $1, expires_at = $2
+		WHERE id = $3
+	`, ipAddress, refreshExpiresAt, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	newToken, err := insertRefreshToken(tx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return newTokenPair(username, sessionID, newToken, refreshExpiresAt)
+}
+
+// SessionUser returns the user a session belongs to, or ok=false if the
+// session doesn't exist or has been revoked or expired. The username comes
+// from the session rather than the token so tokens survive a rename.
+func SessionUser(sessionID int64) (username string, ok bool, err error) {
+	err = db.DB.QueryRow(`
+		SELECT username
+		FROM sessions
+		WHERE id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+	`, sessionID).Scan(&username)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	return username, err == nil, err
+}
+
+// SessionStartedWithin reports whether the session was signed in to within d,
+// for actions that need the user to have proven who they are recently.
+// Refreshing a session doesn't count.
+func SessionStartedWithin(sessionID int64, d time.Duration) (bool, error) {
+	var recent bool
+	err := db.DB.QueryRow(`
+		SELECT created_at > $2 FROM sessions WHERE id = $1
+	`, sessionID, time.Now().Add(-d)).Scan(&recent)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return recent, err
+}
+
+// ListSessions returns the user's active sessions, most recently used first
+func ListSessions(username string) ([]models.Session, error) {
+	rows, err := db.DB.Query(`
+		SELECT id, username, device_name, ip_address, user_agent, created_at, last_seen_at, expires_at
+		FROM sessions
+		WHERE username = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY last_seen_at DESC
+	`, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		var s models.Session
+		err := rows.Scan(&s.ID, &s.Username, &s.DeviceName, &s.IPAddress, &s.UserAgent, &s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// RevokeSession revokes one of the user's sessions. It returns false if the
+// session doesn't exist, belongs to someone else or is already revoked.
+func RevokeSession(username string, sessionID int64) (bool, error) {
+	result, err := db.DB.Exec(`
+		UPDATE sessions SET revoked_at = NOW()
+		WHERE id = $1 AND username = $2 AND revoked_at IS NULL
+	`, sessionID, username)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// RevokeAllSessions revokes every active session for the user except the one
+// given, which may be 0 to revoke them all
+func RevokeAllSessions(username string, exceptSessionID int64) (int64, error) {
+	return revokeAllSessions(db.DB, username, exceptSessionID)
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func revokeAllSessions(ex execer, username string, exceptSessionID int64) (int64, error) {
+	result, err := ex.Exec(`
+		UPDATE sessions SET revoked_at = NOW()
+		WHERE username = $1 AND id != $2 AND revoked_at IS NULL
+	`, username, exceptSessionID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func newTokenPair(username string, sessionID int64, refreshToken string, refreshExpiresAt time.Time) (*TokenPair, error) {
+	accessToken, accessExpiresAt, err := IssueAccessToken(username, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:      accessToken,
+		AccessExpiresAt:  accessExpiresAt,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: refreshExpiresAt,
+	}, nil
+}
+
+func insertRefreshToken(tx *sql.Tx, sessionID int64) (string, error) {
+	token, err := RandomToken()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.Exec(`INSERT INTO refresh_tokens (token_hash, session_id) VALUES ($1, $2)`, HashToken(token), sessionID)
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// RandomToken returns 32 bytes of randomness encoded for use in URLs and headers
+func RandomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken is how opaque tokens are stored, so a database leak doesn't hand
+// out working credentials
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
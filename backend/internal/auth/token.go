@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/BenH9999/CampusConnect/backend/internal/config"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrExpiredToken = errors.New("token has expired")
+)
+
+// Token purposes, so a token issued for one job can't be replayed for another.
+// Access tokens have no purpose set.
+const (
+	PurposeVerifyEmail = "verify_email"
+	PurposeTwoFactor   = "login_2fa"
+)
+
+// twoFactorChallengeTTL is how long a user has to enter their code after
+// getting their password right
+const twoFactorChallengeTTL = 5 * time.Minute
+
+// tokenHeader is the fixed JWT header for HS256 signed tokens
+var tokenHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// Claims is the payload carried inside a signed token
+type Claims struct {
+	Subject   string `json:"sub"`
+	SessionID int64  `json:"sid,omitempty"`
+	Purpose   string `json:"pur,omitempty"`
+	Email     string `json:"email,omitempty"`
+	Device    string `json:"dev,omitempty"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// IssueAccessToken creates a signed access token for the given user session
+func IssueAccessToken(username string, sessionID int64) (string, time.Time, error) {
+	return signClaims(Claims{Subject: username, SessionID: sessionID}, config.GetAccessTokenTTL())
+}
+
+// ParseAccessToken verifies the token signature and expiry and returns its claims
+func ParseAccessToken(token string) (*Claims, error) {
+	return parseClaims(token, "")
+}
+
+// IssueVerificationToken creates a signed token confirming the user owns email
+func IssueVerificationToken(username, email string) (string, error) {
+	token, _, err := signClaims(Claims{Subject: username, Purpose: PurposeVerifyEmail, Email: email}, config.GetEmailVerificationTTL())
+	return token, err
+}
+
+// ParseVerificationToken verifies an email verification token and returns its claims
+func ParseVerificationToken(token string) (*Claims, error) {
+	return parseClaims(token, PurposeVerifyEmail)
+}
+
+// IssueTwoFactorChallenge creates a token showing the user has passed the
+// password step of login and still needs to give a second factor
+func IssueTwoFactorChallenge(username, deviceName string) (string, time.Time, error) {
+	return signClaims(Claims{Subject: username, Purpose: PurposeTwoFactor, Device: deviceName}, twoFactorChallengeTTL)
+}
+
+// ParseTwoFactorChallenge verifies a challenge token from the password step
+func ParseTwoFactorChallenge(token string) (*Claims, error) {
+	return parseClaims(token, PurposeTwoFactor)
+}
+
+func signClaims(claims Claims, ttl time.Duration) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+	claims.IssuedAt = now.Unix()
+	claims.ExpiresAt = expiresAt.Unix()
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	unsigned := tokenHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + sign(unsigned), expiresAt, nil
+}
+
+func parseClaims(token, purpose string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != tokenHeader {
+		return nil, ErrInvalidToken
+	}
+
+	expected := sign(parts[0] + "." + parts[1])
+	if !hmac.Equal([]byte(parts[2]), []byte(expected)) {
+		return nil, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Subject == "" {
+		return nil, ErrInvalidToken
+	}
+
+	if claims.Purpose != purpose {
+		return nil, ErrInvalidToken
+	}
+
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrExpiredToken
+	}
+
+	return &claims, nil
+}
+
+func sign(unsigned string) string {
+	mac := hmac.New(sha256.New, config.GetTokenSecret())
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,246 @@
+package auth
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/BenH9999/CampusConnect/backend/internal/db"
+	"github.com/BenH9999/CampusConnect/backend/internal/totp"
+)
+
+var (
+	ErrTwoFactorEnabled    = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled = errors.New("two-factor authentication is not enabled")
+	ErrNoPendingEnrollment = errors.New("no two-factor enrollment in progress")
+	ErrInvalidCode         = errors.New("invalid two-factor code")
+)
+
+const (
+	totpIssuer        = "CampusConnect"
+	recoveryCodeCount = 10
+	// Recovery codes are 12 characters from this alphabet, about 60 bits
+	recoveryCodeAlphabet = "abcdefghijklmnopqrstuvwxyz234567"
+)
+
+// BeginTOTPEnrollment stores a new pending secret for the user and returns it
+// with the otpauth URI for their authenticator app. 2FA isn't on until the
+// user confirms they can produce a code from it.
+func BeginTOTPEnrollment(username string) (string, string, error) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", "", err
+	}
+
+	result, err := db.DB.Exec(`
+		UPDATE users SET totp_secret = $1, totp_last_step = 0
+		WHERE username = $2 AND totp_enabled_at IS NULL
+	`, secret, username)
+	if err != nil {
+		return "", "", err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return "", "", ErrTwoFactorEnabled
+	}
+
+	return secret, totp.URI(secret, totpIssuer, username), nil
+}
+
+// ConfirmTOTPEnrollment turns 2FA on if code matches the pending secret and
+// returns a fresh set of recovery codes
+func ConfirmTOTPEnrollment(username, code string) ([]string, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var secret sql.NullString
+	var enabledAt sql.NullTime
+	err = tx.QueryRow(`
+		SELECT totp_secret, totp_enabled_at FROM users WHERE username = $1 FOR UPDATE
+	`, username).Scan(&secret, &enabledAt)
+	if err != nil {
+		return nil, err
+	}
+	if enabledAt.Valid {
+		return nil, ErrTwoFactorEnabled
+	}
+	if !secret.Valid {
+		return nil, ErrNoPendingEnrollment
+	}
+
+	step, ok := totp.Validate(secret.String, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+
+	_, err = tx.Exec(`
+		UPDATE users SET totp_enabled_at = NOW(), totp_last_step = $1 WHERE username = $2
+	`, step, username)
+	if err != nil {
+		return nil, err
+	}
+
+	codes, err := replaceRecoveryCodes(tx, username)
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, tx.Commit()
+}
+
+// DisableTOTP turns 2FA off and removes the secret and recovery codes
+func DisableTOTP(username string) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = 0
+		WHERE username = $1 AND totp_enabled_at IS NOT NULL
+	`, username)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrTwoFactorNotEnabled
+	}
+
+	if _, err := tx.Exec(`DELETE FROM recovery_codes WHERE username = $1`, username); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// VerifySecondFactor checks a code from the user's authenticator app, or one
+// of their recovery codes. Each TOTP code and recovery code works only once.
+func VerifySecondFactor(username, code string) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var secret sql.NullString
+	var enabledAt sql.NullTime
+	var lastStep int64
+	err = tx.QueryRow(`
+		SELECT totp_secret, totp_enabled_at, totp_last_step FROM users WHERE username = $1 FOR UPDATE
+	`, username).Scan(&secret, &enabledAt, &lastStep)
+	if err != nil {
+		return err
+	}
+	if !enabledAt.Valid || !secret.Valid {
+		return ErrTwoFactorNotEnabled
+	}
+
+	if step, ok := totp.Validate(secret.String, code, time.Now()); ok {
+		if step <= lastStep {
+			return ErrInvalidCode
+		}
+		_, err = tx.Exec(`UPDATE users SET totp_last_step = $1 WHERE username = $2`, step, username)
+		if err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	result, err := tx.Exec(`
+		UPDATE recovery_codes SET used_at = NOW()
+		WHERE username = $1 AND code_hash = $2 AND used_at IS NULL
+	`, username, HashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrInvalidCode
+	}
+	return tx.Commit()
+}
+
+// RegenerateRecoveryCodes replaces all of the user's recovery codes
+func RegenerateRecoveryCodes(username string) ([]string, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var enabled bool
+	err = tx.QueryRow(`SELECT totp_enabled_at IS NOT NULL FROM users WHERE username = $1 FOR UPDATE`, username).Scan(&enabled)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		return nil, ErrTwoFactorNotEnabled
+	}
+
+	codes, err := replaceRecoveryCodes(tx, username)
+	if err != nil {
+		return nil, err
+	}
+	return codes, tx.Commit()
+}
+
+// RemainingRecoveryCodes counts the user's unused recovery codes
+func RemainingRecoveryCodes(username string) (int, error) {
+	var count int
+	err := db.DB.QueryRow(`
+		SELECT COUNT(*) FROM recovery_codes WHERE username = $1 AND used_at IS NULL
+	`, username).Scan(&count)
+	return count, err
+}
+
+// replaceRecoveryCodes deletes the user's recovery codes and stores hashes of
+// a new set, returning the plain codes to show the user once
+func replaceRecoveryCodes(tx *sql.Tx, username string) ([]string, error) {
+	if _, err := tx.Exec(`DELETE FROM recovery_codes WHERE username = $1`, username); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO recovery_codes (username, code_hash) VALUES ($1, $2)
+		`, username, HashToken(normalizeRecoveryCode(code)))
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// newRecoveryCode returns a code formatted as xxxx-xxxx-xxxx
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	for i, c := range b {
+		if i > 0 && i%4 == 0 {
+			sb.WriteByte('-')
+		}
+		sb.WriteByte(recoveryCodeAlphabet[int(c)%len(recoveryCodeAlphabet)])
+	}
+	return sb.String(), nil
+}
+
+// normalizeRecoveryCode lets users type codes without dashes or in capitals
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
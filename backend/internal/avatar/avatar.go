@@ -0,0 +1,167 @@
+package avatar
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/url"
+	"strconv"
+
+	"github.com/BenH9999/CampusConnect/backend/internal/assets"
+	"github.com/BenH9999/CampusConnect/backend/internal/config"
+	"github.com/BenH9999/CampusConnect/backend/internal/db"
+	"github.com/BenH9999/CampusConnect/backend/internal/imaging"
+)
+
+// The sizes avatars are served at, in pixels square
+const (
+	SizeSmall  = 48
+	SizeMedium = 128
+	SizeLarge  = 400
+)
+
+var Sizes = []int{SizeSmall, SizeMedium, SizeLarge}
+
+// storedSize caps the side of the picture kept in the database, leaving
+// headroom above SizeLarge for high density screens
+const storedSize = 2 * SizeLarge
+
+var (
+	ErrNotFound     = errors.New("user not found")
+	ErrTooLarge     = errors.New("picture is too large")
+	ErrInvalidImage = errors.New("picture is not a JPEG, PNG or GIF image")
+)
+
+type Image struct {
+	Data        []byte
+	ContentType string
+	Version     string
+}
+
+// URL is where clients fetch a user's avatar. version is the user's
+// avatar_version; it changes whenever the picture does, so the URL can be
+// cached indefinitely.
+func URL(username, version string, size int) string {
+	return config.GetPublicBaseURL() + "/api/users/" + url.PathEscape(username) +
+		"/avatar?size=" + strconv.Itoa(size) + "&v=" + url.QueryEscape(version)
+}
+
+// NormalizeSize picks the smallest served size at least as big as requested
+func NormalizeSize(requested int) int {
+	for _, size := range Sizes {
+		if requested <= size {
+			return size
+		}
+	}
+	return Sizes[len(Sizes)-1]
+}
+
+// Variant returns the user's avatar at one of Sizes, generating and caching
+// it the first time it is asked for after the picture changes
+func Variant(username string, size int) (Image, error) {
+	img := Image{}
+	err := db.DB.QueryRow(`SELECT avatar_version FROM users WHERE username = $1`, username).Scan(&img.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return img, ErrNotFound
+	}
+	if err != nil {
+		return img, err
+	}
+
+	err = db.DB.QueryRow(`
+		SELECT content_type, data FROM avatar_variants
+		WHERE username = $1 AND size = $2 AND version = $3
+	`, username, size, img.Version).Scan(&img.ContentType, &img.Data)
+	if err == nil {
+		return img, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return img, err
+	}
+
+	var picture []byte
+	err = db.DB.QueryRow(`SELECT profile_picture, avatar_version FROM users WHERE username = $1`, username).Scan(&picture, &img.Version)
+	if err != nil {
+		return img, err
+	}
+
+	img.Data, img.ContentType, err = render(picture, size)
+	if err != nil {
+		return img, err
+	}
+
+	_, err = db.DB.Exec(`
+		INSERT INTO avatar_variants (username, size, version, content_type, data)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (username, size) DO UPDATE
+		SET version = $3, content_type = $4, data = $5, created_at = NOW()
+	`, username, size, img.Version, img.ContentType, img.Data)
+	return img, err
+}
+
+// Normalize validates an uploaded picture and returns the copy to store: turned
+// upright, cropped square, scaled down to storedSize and re-encoded. Encoding
+// from decoded pixels drops EXIF and any other metadata, such as GPS location.
+func Normalize(data []byte) ([]byte, error) {
+	if int64(len(data)) > config.GetMaxAvatarBytes() {
+		return nil, ErrTooLarge
+	}
+	src, err := decode(data)
+	if err != nil {
+		if errors.Is(err, errTooManyPixels) {
+			return nil, ErrTooLarge
+		}
+		return nil, ErrInvalidImage
+	}
+
+	square := imaging.CropSquare(imaging.Orient(src, imaging.Orientation(data)))
+	side := min(storedSize, square.Bounds().Dx())
+	out, _, err := encode(imaging.Resize(square, side, side))
+	return out, err
+}
+
+// render crops the picture square and scales it down to size. Pictures that
+// are missing or can't be decoded get the default avatar instead.
+func render(picture []byte, size int) ([]byte, string, error) {
+	src, err := decode(picture)
+	if err != nil {
+		if src, err = decode(assets.DefaultAvatar); err != nil {
+			return nil, "", err
+		}
+	}
+
+	square := imaging.CropSquare(src)
+	side := min(size, square.Bounds().Dx())
+	return encode(imaging.Resize(square, side, side))
+}
+
+// encode writes opaque images as JPEG and anything with transparency as PNG
+func encode(img image.Image) ([]byte, string, error) {
+	var buf bytes.Buffer
+	if imaging.Opaque(img) {
+		err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85})
+		return buf.Bytes(), "image/jpeg", err
+	}
+	err := png.Encode(&buf, img)
+	return buf.Bytes(), "image/png", err
+}
+
+var errTooManyPixels = errors.New("picture dimensions are too large")
+
+func decode(data []byte) (image.Image, error) {
+	if len(data) == 0 {
+		return nil, errors.New("no picture")
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width > imaging.MaxDimension || cfg.Height > imaging.MaxDimension {
+		return nil, errTooManyPixels
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	return img, err
+}
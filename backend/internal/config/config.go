@@ -1,8 +1,19 @@
 package config
 
 import (
+	"crypto/rand"
 	"fmt"
+	"log"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	tokenSecret     []byte
+	tokenSecretOnce sync.Once
 )
 
 // GetDatabaseURL constructs a database connection string from environment variables
@@ -21,9 +32,272 @@ func GetDatabaseURL() string {
 		user, password, host, port, dbname)
 }
 
+// GetTokenSecret returns the key used to sign access tokens. If TOKEN_SECRET is
+// not set a random key is generated, which means tokens won't survive a restart.
+func GetTokenSecret() []byte {
+	tokenSecretOnce.Do(func() {
+		if secret := os.Getenv("TOKEN_SECRET"); secret != "" {
+			tokenSecret = []byte(secret)
+			return
+		}
+
+		log.Println("TOKEN_SECRET not set, generating a random signing key")
+		tokenSecret = make([]byte, 32)
+		if _, err := rand.Read(tokenSecret); err != nil {
+			log.Fatal("Failed to generate token secret: ", err)
+		}
+	})
+	return tokenSecret
+}
+
+// GetAccessTokenTTL returns how long an access token stays valid
+func GetAccessTokenTTL() time.Duration {
+	return getDurationWithDefault("ACCESS_TOKEN_TTL", 15*time.Minute)
+}
+
+// GetRefreshTokenTTL returns how long a session can go without being refreshed
+func GetRefreshTokenTTL() time.Duration {
+	return getDurationWithDefault("REFRESH_TOKEN_TTL", 30*24*time.Hour)
+}
+
+// GetEmailVerificationTTL returns how long an email verification link stays valid
+func GetEmailVerificationTTL() time.Duration {
+	return getDurationWithDefault("EMAIL_VERIFICATION_TTL", 48*time.Hour)
+}
+
+// GetVerificationResendCooldown returns the minimum time between verification emails
+func GetVerificationResendCooldown() time.Duration {
+	return getDurationWithDefault("VERIFICATION_RESEND_COOLDOWN", 2*time.Minute)
+}
+
+// GetPublicBaseURL returns the externally reachable URL of the API, used to
+// build links that go out in emails
+func GetPublicBaseURL() string {
+	return strings.TrimRight(getEnvWithDefault("PUBLIC_BASE_URL", "http://localhost:8080"), "/")
+}
+
+// GetPasswordResetTTL returns how long a password reset link stays valid
+func GetPasswordResetTTL() time.Duration {
+	return getDurationWithDefault("PASSWORD_RESET_TTL", time.Hour)
+}
+
+// GetPasswordResetCooldown returns the minimum time between password reset
+// emails to one account
+func GetPasswordResetCooldown() time.Duration {
+	return getDurationWithDefault("PASSWORD_RESET_COOLDOWN", 2*time.Minute)
+}
+
+// GetAccountDeletionGracePeriod returns how long a deleted account can still
+// be restored before its data is removed
+func GetAccountDeletionGracePeriod() time.Duration {
+	return getDurationWithDefault("ACCOUNT_DELETION_GRACE_PERIOD", 14*24*time.Hour)
+}
+
+// GetUsernameReclaimCooldown returns how long a username given up in a
+// rename stays reserved for its previous owner
+func GetUsernameReclaimCooldown() time.Duration {
+	return getDurationWithDefault("USERNAME_RECLAIM_COOLDOWN", 90*24*time.Hour)
+}
+
+// GetTrendingWindow returns how far back trending tags look
+func GetTrendingWindow() time.Duration {
+	return getDurationWithDefault("TRENDING_WINDOW", 24*time.Hour)
+}
+
+// GetLinkPreviewTimeout returns how long fetching a page for a link preview
+// can take in total, redirects included
+func GetLinkPreviewTimeout() time.Duration {
+	return getDurationWithDefault("LINK_PREVIEW_TIMEOUT", 5*time.Second)
+}
+
+// GetLinkPreviewTTL returns how long a fetched link preview is reused before
+// the page is fetched again
+func GetLinkPreviewTTL() time.Duration {
+	return getDurationWithDefault("LINK_PREVIEW_TTL", 24*time.Hour)
+}
+
+// GetDataExportTTL returns how long a finished data export can be downloaded
+func GetDataExportTTL() time.Duration {
+	return getDurationWithDefault("DATA_EXPORT_TTL", 7*24*time.Hour)
+}
+
+// GetPasswordResetURL returns the app link that password reset emails point
+// to; the reset token is appended as a query parameter
+func GetPasswordResetURL() string {
+	return getEnvWithDefault("PASSWORD_RESET_URL", "myapp://reset-password")
+}
+
+// GetAllowedEmailDomains returns the email domains that may register, from
+// the comma separated ALLOWED_EMAIL_DOMAINS. An empty list allows any domain.
+func GetAllowedEmailDomains() []string {
+	var domains []string
+	for _, domain := range getListFromEnv("ALLOWED_EMAIL_DOMAINS") {
+		domains = append(domains, strings.ToLower(domain))
+	}
+	return domains
+}
+
+// GetEmailDomainAffiliations maps email domains to the affiliation given to
+// users who register with them, from EMAIL_DOMAIN_AFFILIATIONS in the form
+// "student.uni.ac.uk=student,uni.ac.uk=staff"
+func GetEmailDomainAffiliations() map[string]string {
+	affiliations := map[string]string{}
+	for _, entry := range getListFromEnv("EMAIL_DOMAIN_AFFILIATIONS") {
+		domain, affiliation, found := strings.Cut(entry, "=")
+		if !found {
+			log.Printf("Ignoring malformed EMAIL_DOMAIN_AFFILIATIONS entry %q", entry)
+			continue
+		}
+		affiliations[strings.ToLower(strings.TrimSpace(domain))] = strings.TrimSpace(affiliation)
+	}
+	return affiliations
+}
+
+// GetDefaultAffiliation returns the affiliation for domains with no explicit mapping
+func GetDefaultAffiliation() string {
+	return getEnvWithDefault("DEFAULT_AFFILIATION", "student")
+}
+
+// GetAdminUsernames returns the users who always hold the admin role
+func GetAdminUsernames() []string {
+	return getListFromEnv("ADMIN_USERNAMES")
+}
+
+// OIDCConfig holds the settings for single sign-on with the university identity provider
+type OIDCConfig struct {
+	Issuer         string
+	ClientID       string
+	ClientSecret   string
+	RedirectURL    string
+	AppRedirectURL string
+	Scopes         []string
+}
+
+// GetOIDCConfig reads the single sign-on settings. SSO is disabled when
+// OIDC_ISSUER is not set.
+func GetOIDCConfig() OIDCConfig {
+	scopes := strings.Fields(getEnvWithDefault("OIDC_SCOPES", "openid email profile"))
+	return OIDCConfig{
+		Issuer:         strings.TrimRight(os.Getenv("OIDC_ISSUER"), "/"),
+		ClientID:       os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret:   os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:    getEnvWithDefault("OIDC_REDIRECT_URL", GetPublicBaseURL()+"/api/oidc/callback"),
+		AppRedirectURL: getEnvWithDefault("OIDC_APP_REDIRECT_URL", "myapp://oidc-callback"),
+		Scopes:         scopes,
+	}
+}
+
+// GetLoginThrottleStore returns where failed login attempts are tracked,
+// either "postgres" or "memory"
+func GetLoginThrottleStore() string {
+	return getEnvWithDefault("LOGIN_THROTTLE_STORE", "postgres")
+}
+
+// MailConfig holds the settings for outgoing email
+type MailConfig struct {
+	Driver       string
+	From         string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	LogPath      string
+}
+
+// GetMailConfig reads the outgoing email settings. MAIL_DRIVER is either
+// "smtp" or "log"; the log driver writes emails to MAIL_LOG_PATH or stdout.
+func GetMailConfig() MailConfig {
+	return MailConfig{
+		Driver:       getEnvWithDefault("MAIL_DRIVER", "log"),
+		From:         getEnvWithDefault("MAIL_FROM", "CampusConnect <no-reply@campusconnect.local>"),
+		SMTPHost:     os.Getenv("SMTP_HOST"),
+		SMTPPort:     getEnvWithDefault("SMTP_PORT", "587"),
+		SMTPUsername: os.Getenv("SMTP_USERNAME"),
+		SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+		LogPath:      os.Getenv("MAIL_LOG_PATH"),
+	}
+}
+
+// StorageConfig holds the settings for where uploaded media is kept
+type StorageConfig struct {
+	Driver           string
+	LocalPath        string
+	S3Endpoint       string
+	S3Region         string
+	S3Bucket         string
+	S3AccessKeyID    string
+	S3SecretKey      string
+	S3ForcePathStyle bool
+}
+
+// GetStorageConfig reads the media storage settings. STORAGE_DRIVER is either
+// "local", which writes under STORAGE_LOCAL_PATH, or "s3" for AWS S3 or a
+// compatible service such as MinIO at S3_ENDPOINT.
+func GetStorageConfig() StorageConfig {
+	return StorageConfig{
+		Driver:           getEnvWithDefault("STORAGE_DRIVER", "local"),
+		LocalPath:        getEnvWithDefault("STORAGE_LOCAL_PATH", "uploads"),
+		S3Endpoint:       strings.TrimRight(os.Getenv("S3_ENDPOINT"), "/"),
+		S3Region:         getEnvWithDefault("S3_REGION", "us-east-1"),
+		S3Bucket:         os.Getenv("S3_BUCKET"),
+		S3AccessKeyID:    os.Getenv("S3_ACCESS_KEY_ID"),
+		S3SecretKey:      os.Getenv("S3_SECRET_ACCESS_KEY"),
+		S3ForcePathStyle: getEnvWithDefault("S3_FORCE_PATH_STYLE", "true") == "true",
+	}
+}
+
+// GetMaxUploadBytes returns the largest media file that can be uploaded
+func GetMaxUploadBytes() int64 {
+	return int64(getIntWithDefault("MEDIA_MAX_UPLOAD_BYTES", 10<<20))
+}
+
+// GetMaxAvatarBytes returns the largest profile picture that can be uploaded
+func GetMaxAvatarBytes() int64 {
+	return int64(getIntWithDefault("AVATAR_MAX_UPLOAD_BYTES", 5<<20))
+}
+
 func getEnvWithDefault(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
 	}
 	return defaultValue
 }
+
+// getListFromEnv splits a comma separated variable into trimmed, non-empty entries
+func getListFromEnv(key string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func getIntWithDefault(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		log.Printf("Invalid number for %s, using default %d", key, defaultValue)
+		return defaultValue
+	}
+	return n
+}
+
+func getDurationWithDefault(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid duration for %s, using default %v", key, defaultValue)
+		return defaultValue
+	}
+	return d
+}
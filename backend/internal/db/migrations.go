@@ -1,9 +1,10 @@
 package db
 
 import (
-	"encoding/base64"
 	"log"
 
+	"github.com/BenH9999/CampusConnect/backend/internal/assets"
+
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -25,6 +26,53 @@ func InitTables() {
 	}
 	log.Println("Created users table")
 
+	// Accounts that existed before verification was introduced are treated as
+	// verified: the default only applies to rows present when the column is
+	// first added, and is dropped straight after
+	addEmailVerificationColumns := `
+        ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMP WITH TIME ZONE DEFAULT now();
+        ALTER TABLE users ALTER COLUMN email_verified_at DROP DEFAULT;
+        ALTER TABLE users ADD COLUMN IF NOT EXISTS verification_sent_at TIMESTAMP WITH TIME ZONE;
+    `
+	_, err = DB.Exec(addEmailVerificationColumns)
+	if err != nil {
+		log.Fatal("Error adding email verification columns: ", err)
+	}
+
+	_, err = DB.Exec(`ALTER TABLE users ADD COLUMN IF NOT EXISTS affiliation VARCHAR(20) NOT NULL DEFAULT 'student'`)
+	if err != nil {
+		log.Fatal("Error adding affiliation column: ", err)
+	}
+
+	addTwoFactorColumns := `
+        ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_secret VARCHAR(64);
+        ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_enabled_at TIMESTAMP WITH TIME ZONE;
+        ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_last_step BIGINT NOT NULL DEFAULT 0;
+    `
+	_, err = DB.Exec(addTwoFactorColumns)
+	if err != nil {
+		log.Fatal("Error adding two-factor columns: ", err)
+	}
+
+	// Whether mentions from people who don't follow the user notify them
+	_, err = DB.Exec(`ALTER TABLE users ADD COLUMN IF NOT EXISTS notify_mentions_from_non_followers BOOLEAN NOT NULL DEFAULT TRUE`)
+	if err != nil {
+		log.Fatal("Error adding notify_mentions_from_non_followers column: ", err)
+	}
+
+	// A short hash of the profile picture, used in avatar URLs so they change
+	// whenever the picture does
+	_, err = DB.Exec(`ALTER TABLE users ADD COLUMN IF NOT EXISTS avatar_version VARCHAR(16) GENERATED ALWAYS AS (substr(md5(profile_picture), 1, 16)) STORED`)
+	if err != nil {
+		log.Fatal("Error adding avatar_version column: ", err)
+	}
+
+	// Subject of the linked university SSO account, if any
+	_, err = DB.Exec(`ALTER TABLE users ADD COLUMN IF NOT EXISTS oidc_subject VARCHAR(255) UNIQUE`)
+	if err != nil {
+		log.Fatal("Error adding oidc_subject column: ", err)
+	}
+
 	createPostsTable := `
         CREATE TABLE IF NOT EXISTS posts (
         id SERIAL PRIMARY KEY,
@@ -144,6 +192,471 @@ func InitTables() {
 	}
 	log.Println("Created messages table")
 
+	createSessionsTable := `
+        CREATE TABLE IF NOT EXISTS sessions (
+        id SERIAL PRIMARY KEY,
+        username VARCHAR(50) NOT NULL REFERENCES users(username) ON DELETE CASCADE,
+        device_name VARCHAR(100) NOT NULL DEFAULT '',
+        ip_address VARCHAR(64) NOT NULL DEFAULT '',
+        user_agent TEXT NOT NULL DEFAULT '',
+        created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+        last_seen_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+        expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+        revoked_at TIMESTAMP WITH TIME ZONE
+        );
+        CREATE INDEX IF NOT EXISTS idx_sessions_username ON sessions(username);
+    `
+	_, err = DB.Exec(createSessionsTable)
+	if err != nil {
+		log.Fatal("Error creating sessions table: ", err)
+	}
+	log.Println("Created sessions table")
+
+	// Every refresh token ever issued is kept so that a rotated token being
+	// presented again can be detected as reuse
+	createRefreshTokensTable := `
+        CREATE TABLE IF NOT EXISTS refresh_tokens (
+        token_hash CHAR(64) PRIMARY KEY,
+        session_id INT NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+        created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+        used_at TIMESTAMP WITH TIME ZONE
+        );
+    `
+	_, err = DB.Exec(createRefreshTokensTable)
+	if err != nil {
+		log.Fatal("Error creating refresh_tokens table: ", err)
+	}
+	log.Println("Created refresh_tokens table")
+
+	createPasswordResetsTable := `
+        CREATE TABLE IF NOT EXISTS password_resets (
+        token_hash CHAR(64) PRIMARY KEY,
+        username VARCHAR(50) NOT NULL REFERENCES users(username) ON DELETE CASCADE,
+        created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+        expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+        used_at TIMESTAMP WITH TIME ZONE
+        );
+    `
+	_, err = DB.Exec(createPasswordResetsTable)
+	if err != nil {
+		log.Fatal("Error creating password_resets table: ", err)
+	}
+	log.Println("Created password_resets table")
+
+	// Domains added by admins at runtime, on top of ALLOWED_EMAIL_DOMAINS
+	createAllowedEmailDomainsTable := `
+        CREATE TABLE IF NOT EXISTS allowed_email_domains (
+        domain VARCHAR(100) PRIMARY KEY,
+        affiliation VARCHAR(20) NOT NULL,
+        added_by VARCHAR(50) REFERENCES users(username) ON DELETE SET NULL,
+        created_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+        );
+    `
+	_, err = DB.Exec(createAllowedEmailDomainsTable)
+	if err != nil {
+		log.Fatal("Error creating allowed_email_domains table: ", err)
+	}
+	log.Println("Created allowed_email_domains table")
+
+	// In-flight SSO logins, keyed by the state parameter sent to the provider
+	createOIDCStatesTable := `
+        CREATE TABLE IF NOT EXISTS oidc_states (
+        state VARCHAR(64) PRIMARY KEY,
+        code_verifier VARCHAR(128) NOT NULL,
+        nonce VARCHAR(64) NOT NULL,
+        device_name VARCHAR(100) NOT NULL DEFAULT '',
+        expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+        );
+    `
+	_, err = DB.Exec(createOIDCStatesTable)
+	if err != nil {
+		log.Fatal("Error creating oidc_states table: ", err)
+	}
+	log.Println("Created oidc_states table")
+
+	// Hash of the cookie set on the browser that started the login, so the
+	// callback only completes in that same browser
+	_, err = DB.Exec(`ALTER TABLE oidc_states ADD COLUMN IF NOT EXISTS binding_hash CHAR(64) NOT NULL DEFAULT ''`)
+	if err != nil {
+		log.Fatal("Error adding oidc_states binding_hash column: ", err)
+	}
+
+	// One-time codes handed to the app after SSO, exchanged for a session
+	createOIDCHandoffsTable := `
+        CREATE TABLE IF NOT EXISTS oidc_handoffs (
+        code_hash CHAR(64) PRIMARY KEY,
+        username VARCHAR(50) NOT NULL REFERENCES users(username) ON DELETE CASCADE,
+        device_name VARCHAR(100) NOT NULL DEFAULT '',
+        expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+        );
+    `
+	_, err = DB.Exec(createOIDCHandoffsTable)
+	if err != nil {
+		log.Fatal("Error creating oidc_handoffs table: ", err)
+	}
+	log.Println("Created oidc_handoffs table")
+
+	// Failed login attempts per account and per IP, used for backoff and lockout
+	createLoginAttemptsTable := `
+        CREATE TABLE IF NOT EXISTS login_attempts (
+        key VARCHAR(150) PRIMARY KEY,
+        failures INT NOT NULL DEFAULT 0,
+        last_failure_at TIMESTAMP WITH TIME ZONE NOT NULL,
+        blocked_until TIMESTAMP WITH TIME ZONE,
+        locked BOOLEAN NOT NULL DEFAULT FALSE
+        );
+    `
+	_, err = DB.Exec(createLoginAttemptsTable)
+	if err != nil {
+		log.Fatal("Error creating login_attempts table: ", err)
+	}
+	log.Println("Created login_attempts table")
+
+	createRecoveryCodesTable := `
+        CREATE TABLE IF NOT EXISTS recovery_codes (
+        id SERIAL PRIMARY KEY,
+        username VARCHAR(50) NOT NULL REFERENCES users(username) ON DELETE CASCADE,
+        code_hash CHAR(64) NOT NULL,
+        used_at TIMESTAMP WITH TIME ZONE,
+        created_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+        );
+        CREATE INDEX IF NOT EXISTS idx_recovery_codes_username ON recovery_codes(username);
+    `
+	_, err = DB.Exec(createRecoveryCodesTable)
+	if err != nil {
+		log.Fatal("Error creating recovery_codes table: ", err)
+	}
+	log.Println("Created recovery_codes table")
+
+	// Roles beyond the student role every account has. Admins listed in
+	// ADMIN_USERNAMES aren't stored here.
+	createUserRolesTable := `
+        CREATE TABLE IF NOT EXISTS user_roles (
+        username VARCHAR(50) NOT NULL REFERENCES users(username) ON DELETE CASCADE,
+        role VARCHAR(20) NOT NULL,
+        granted_by VARCHAR(50) REFERENCES users(username) ON DELETE SET NULL,
+        granted_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+        PRIMARY KEY (username, role)
+        );
+    `
+	_, err = DB.Exec(createUserRolesTable)
+	if err != nil {
+		log.Fatal("Error creating user_roles table: ", err)
+	}
+	log.Println("Created user_roles table")
+
+	_, err = DB.Exec(`ALTER TABLE users ADD COLUMN IF NOT EXISTS deletion_scheduled_for TIMESTAMP WITH TIME ZONE`)
+	if err != nil {
+		log.Fatal("Error adding deletion_scheduled_for column: ", err)
+	}
+
+	createDataExportsTable := `
+        CREATE TABLE IF NOT EXISTS data_exports (
+        id SERIAL PRIMARY KEY,
+        username VARCHAR(50) NOT NULL REFERENCES users(username) ON DELETE CASCADE,
+        status VARCHAR(20) NOT NULL DEFAULT 'pending',
+        archive BYTEA,
+        created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+        started_at TIMESTAMP WITH TIME ZONE,
+        completed_at TIMESTAMP WITH TIME ZONE,
+        expires_at TIMESTAMP WITH TIME ZONE
+        );
+        CREATE INDEX IF NOT EXISTS idx_data_exports_username ON data_exports(username);
+    `
+	_, err = DB.Exec(createDataExportsTable)
+	if err != nil {
+		log.Fatal("Error creating data_exports table: ", err)
+	}
+	log.Println("Created data_exports table")
+
+	addPostEditColumns := `
+        ALTER TABLE posts ADD COLUMN IF NOT EXISTS edited_at TIMESTAMP WITH TIME ZONE;
+    `
+	_, err = DB.Exec(addPostEditColumns)
+	if err != nil {
+		log.Fatal("Error adding post edit columns: ", err)
+	}
+
+	// Earlier versions of edited posts, oldest first
+	createPostRevisionsTable := `
+        CREATE TABLE IF NOT EXISTS post_revisions (
+        id SERIAL PRIMARY KEY,
+        post_id INT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+        content TEXT NOT NULL,
+        created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+        replaced_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+        );
+        CREATE INDEX IF NOT EXISTS idx_post_revisions_post_id ON post_revisions(post_id);
+    `
+	_, err = DB.Exec(createPostRevisionsTable)
+	if err != nil {
+		log.Fatal("Error creating post_revisions table: ", err)
+	}
+	log.Println("Created post_revisions table")
+
+	createAttachmentsTable := `
+        CREATE TABLE IF NOT EXISTS attachments (
+        id SERIAL PRIMARY KEY,
+        username VARCHAR(50) REFERENCES users(username) ON DELETE SET NULL,
+        post_id INT REFERENCES posts(id) ON DELETE SET NULL,
+        position SMALLINT NOT NULL DEFAULT 0,
+        storage_key VARCHAR(255) NOT NULL UNIQUE,
+        mime_type VARCHAR(100) NOT NULL,
+        alt_text TEXT NOT NULL DEFAULT '',
+        width INT NOT NULL DEFAULT 0,
+        height INT NOT NULL DEFAULT 0,
+        size_bytes BIGINT NOT NULL,
+        created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+        attached_at TIMESTAMP WITH TIME ZONE
+        );
+        CREATE INDEX IF NOT EXISTS idx_attachments_post_id ON attachments(post_id);
+    `
+	_, err = DB.Exec(createAttachmentsTable)
+	if err != nil {
+		log.Fatal("Error creating attachments table: ", err)
+	}
+	log.Println("Created attachments table")
+
+	// Resized copies of profile pictures, regenerated when the version changes
+	createAvatarVariantsTable := `
+        CREATE TABLE IF NOT EXISTS avatar_variants (
+        username VARCHAR(50) NOT NULL REFERENCES users(username) ON DELETE CASCADE,
+        size SMALLINT NOT NULL,
+        version VARCHAR(16) NOT NULL,
+        content_type VARCHAR(50) NOT NULL,
+        data BYTEA NOT NULL,
+        created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+        PRIMARY KEY (username, size)
+        );
+    `
+	_, err = DB.Exec(createAvatarVariantsTable)
+	if err != nil {
+		log.Fatal("Error creating avatar_variants table: ", err)
+	}
+	log.Println("Created avatar_variants table")
+
+	// Hashtags parsed out of post content. created_at copies the post's so
+	// trending can scan a time window without joining posts.
+	createPostHashtagsTable := `
+        CREATE TABLE IF NOT EXISTS post_hashtags (
+        post_id INT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+        tag VARCHAR(50) NOT NULL,
+        created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+        PRIMARY KEY (post_id, tag)
+        );
+        DROP INDEX IF EXISTS idx_post_hashtags_tag;
+        CREATE INDEX IF NOT EXISTS idx_post_hashtags_tag_created_at ON post_hashtags(tag, created_at DESC, post_id DESC);
+        CREATE INDEX IF NOT EXISTS idx_post_hashtags_created_at ON post_hashtags(created_at);
+    `
+	_, err = DB.Exec(createPostHashtagsTable)
+	if err != nil {
+		log.Fatal("Error creating post_hashtags table: ", err)
+	}
+	log.Println("Created post_hashtags table")
+
+	// Snapshot of the trending tags, rebuilt by a background job
+	createTrendingHashtagsTable := `
+        CREATE TABLE IF NOT EXISTS trending_hashtags (
+        rank INT PRIMARY KEY,
+        tag VARCHAR(50) NOT NULL,
+        post_count INT NOT NULL,
+        author_count INT NOT NULL,
+        computed_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+        );
+    `
+	_, err = DB.Exec(createTrendingHashtagsTable)
+	if err != nil {
+		log.Fatal("Error creating trending_hashtags table: ", err)
+	}
+	log.Println("Created trending_hashtags table")
+
+	// @mentions resolved to users, in either a post or a comment
+	createMentionsTable := `
+        CREATE TABLE IF NOT EXISTS mentions (
+        id SERIAL PRIMARY KEY,
+        post_id INT REFERENCES posts(id) ON DELETE CASCADE,
+        comment_id INT REFERENCES comments(id) ON DELETE CASCADE,
+        username VARCHAR(50) NOT NULL REFERENCES users(username) ON DELETE CASCADE,
+        start_offset INT NOT NULL,
+        end_offset INT NOT NULL,
+        CHECK ((post_id IS NULL) <> (comment_id IS NULL))
+        );
+        CREATE INDEX IF NOT EXISTS idx_mentions_post_id ON mentions(post_id);
+        CREATE INDEX IF NOT EXISTS idx_mentions_comment_id ON mentions(comment_id);
+    `
+	_, err = DB.Exec(createMentionsTable)
+	if err != nil {
+		log.Fatal("Error creating mentions table: ", err)
+	}
+	log.Println("Created mentions table")
+
+	// Who can see a post; see models.Visibility
+	_, err = DB.Exec(`ALTER TABLE posts ADD COLUMN IF NOT EXISTS visibility VARCHAR(20) NOT NULL DEFAULT 'public'`)
+	if err != nil {
+		log.Fatal("Error adding post visibility column: ", err)
+	}
+
+	// Drafts and scheduled posts are unpublished; scheduled ones have a
+	// publish_at. created_at is reset when a post goes out, so feeds order
+	// it by when it was published.
+	addPostPublishingColumns := `
+        ALTER TABLE posts ADD COLUMN IF NOT EXISTS published BOOLEAN NOT NULL DEFAULT TRUE;
+        ALTER TABLE posts ADD COLUMN IF NOT EXISTS publish_at TIMESTAMP WITH TIME ZONE;
+        CREATE INDEX IF NOT EXISTS idx_posts_publish_at ON posts(publish_at) WHERE NOT published;
+    `
+	_, err = DB.Exec(addPostPublishingColumns)
+	if err != nil {
+		log.Fatal("Error adding post publishing columns: ", err)
+	}
+
+	// A quote post embeds the post it quotes
+	_, err = DB.Exec(`ALTER TABLE posts ADD COLUMN IF NOT EXISTS quoted_post_id INT REFERENCES posts(id) ON DELETE SET NULL`)
+	if err != nil {
+		log.Fatal("Error adding quoted_post_id column: ", err)
+	}
+
+	// The post shown at the top of a user's profile; deleting the post
+	// clears the pin
+	_, err = DB.Exec(`ALTER TABLE users ADD COLUMN IF NOT EXISTS pinned_post_id INT REFERENCES posts(id) ON DELETE SET NULL`)
+	if err != nil {
+		log.Fatal("Error adding pinned_post_id column: ", err)
+	}
+
+	createRepostsTable := `
+        CREATE TABLE IF NOT EXISTS reposts (
+        username VARCHAR(50) NOT NULL REFERENCES users(username) ON DELETE CASCADE,
+        post_id INT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+        created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+        PRIMARY KEY (username, post_id)
+        );
+        CREATE INDEX IF NOT EXISTS idx_reposts_post_id ON reposts(post_id);
+    `
+	_, err = DB.Exec(createRepostsTable)
+	if err != nil {
+		log.Fatal("Error creating reposts table: ", err)
+	}
+	log.Println("Created reposts table")
+
+	// A post can carry one poll. close_notified records that the author has
+	// been told the poll closed.
+	createPollTables := `
+        CREATE TABLE IF NOT EXISTS polls (
+        post_id INT PRIMARY KEY REFERENCES posts(id) ON DELETE CASCADE,
+        multiple_choice BOOLEAN NOT NULL DEFAULT FALSE,
+        closes_at TIMESTAMP WITH TIME ZONE,
+        close_notified BOOLEAN NOT NULL DEFAULT FALSE
+        );
+        CREATE INDEX IF NOT EXISTS idx_polls_closes_at ON polls(closes_at) WHERE NOT close_notified;
+
+        CREATE TABLE IF NOT EXISTS poll_options (
+        id SERIAL PRIMARY KEY,
+        post_id INT NOT NULL REFERENCES polls(post_id) ON DELETE CASCADE,
+        position INT NOT NULL,
+        text VARCHAR(100) NOT NULL,
+        UNIQUE (post_id, position)
+        );
+
+        CREATE TABLE IF NOT EXISTS poll_votes (
+        post_id INT NOT NULL REFERENCES polls(post_id) ON DELETE CASCADE,
+        option_id INT NOT NULL REFERENCES poll_options(id) ON DELETE CASCADE,
+        username VARCHAR(50) NOT NULL REFERENCES users(username) ON DELETE CASCADE,
+        created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+        PRIMARY KEY (option_id, username)
+        );
+        CREATE INDEX IF NOT EXISTS idx_poll_votes_post_username ON poll_votes(post_id, username);
+    `
+	_, err = DB.Exec(createPollTables)
+	if err != nil {
+		log.Fatal("Error creating poll tables: ", err)
+	}
+	log.Println("Created poll tables")
+
+	// Bookmarks are private to the user who saved them. The serial id
+	// orders them for paging, as posts are saved in any order.
+	createBookmarksTable := `
+        CREATE TABLE IF NOT EXISTS bookmarks (
+        id SERIAL PRIMARY KEY,
+        username VARCHAR(50) NOT NULL REFERENCES users(username) ON DELETE CASCADE,
+        post_id INT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+        created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+        UNIQUE (username, post_id)
+        );
+        CREATE INDEX IF NOT EXISTS idx_bookmarks_username_id ON bookmarks(username, id DESC);
+        CREATE INDEX IF NOT EXISTS idx_bookmarks_post_id ON bookmarks(post_id);
+    `
+	_, err = DB.Exec(createBookmarksTable)
+	if err != nil {
+		log.Fatal("Error creating bookmarks table: ", err)
+	}
+	log.Println("Created bookmarks table")
+
+	// post_links are the links found in each post; link_previews caches what
+	// was fetched for each URL, including failures (ok = false)
+	createLinkPreviewTables := `
+        CREATE TABLE IF NOT EXISTS post_links (
+        post_id INT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+        position INT NOT NULL,
+        url TEXT NOT NULL,
+        PRIMARY KEY (post_id, position)
+        );
+        CREATE INDEX IF NOT EXISTS idx_post_links_url ON post_links(url);
+
+        CREATE TABLE IF NOT EXISTS link_previews (
+        url TEXT PRIMARY KEY,
+        ok BOOLEAN NOT NULL,
+        title TEXT NOT NULL DEFAULT '',
+        description TEXT NOT NULL DEFAULT '',
+        image_url TEXT NOT NULL DEFAULT '',
+        site_name TEXT NOT NULL DEFAULT '',
+        fetched_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+        );
+    `
+	_, err = DB.Exec(createLinkPreviewTables)
+	if err != nil {
+		log.Fatal("Error creating link preview tables: ", err)
+	}
+	log.Println("Created link preview tables")
+
+	// Old usernames redirect to the account's current one, and can't be
+	// taken by anyone else until reclaimable_at
+	createUsernameHistoryTable := `
+        CREATE TABLE IF NOT EXISTS username_history (
+        old_username VARCHAR(50) PRIMARY KEY,
+        username VARCHAR(50) NOT NULL REFERENCES users(username) ON DELETE CASCADE ON UPDATE CASCADE,
+        changed_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+        reclaimable_at TIMESTAMP WITH TIME ZONE NOT NULL
+        );
+        CREATE UNIQUE INDEX IF NOT EXISTS idx_username_history_lower ON username_history(LOWER(old_username));
+    `
+	_, err = DB.Exec(createUsernameHistoryTable)
+	if err != nil {
+		log.Fatal("Error creating username_history table: ", err)
+	}
+	log.Println("Created username_history table")
+
+	// Usernames can be changed, so every reference to users(username) has
+	// to follow the rename. This runs after all tables are created and
+	// recreates any foreign key that doesn't cascade updates yet, keeping
+	// its ON DELETE behaviour.
+	cascadeUsernameUpdates := `
+        DO $$
+        DECLARE fk RECORD;
+        BEGIN
+            FOR fk IN
+                SELECT conrelid::regclass AS tbl, conname, pg_get_constraintdef(oid) AS def
+                FROM pg_constraint
+                WHERE contype = 'f' AND confrelid = 'users'::regclass AND confupdtype <> 'c'
+            LOOP
+                EXECUTE format('ALTER TABLE %s DROP CONSTRAINT %I, ADD CONSTRAINT %I %s ON UPDATE CASCADE',
+                    fk.tbl, fk.conname, fk.conname, fk.def);
+            END LOOP;
+        END $$;
+    `
+	_, err = DB.Exec(cascadeUsernameUpdates)
+	if err != nil {
+		log.Fatal("Error making username foreign keys cascade: ", err)
+	}
+
 	// After all tables are created, add sample data
 	TempData()
 }
@@ -151,15 +664,6 @@ func InitTables() {
 func TempData() {
 	log.Println("Inserting sample data...")
 
-	// Using the same hardcoded default profile picture as in auth.go
-	defaultProfilePictureBase64 := "iVBORw0KGgoAAAANSUhEUgAAAZAAAAGQCAMAAAC3Ycb+AAACKFBMVEXM1t3K1Nu7xs6tusOisLqYprGMm6eGlaJ/j5x4iZZzhJJuf45sfYzJ09vBzNSsucKXprGEk6B0hJJmeIdld4bAy9OlsryLmqZxgpC3w8uXpbC+ydGZp7J0hZPL1dyrt8GAkJ3H0tmeq7ZwgZDG0NiaqLNtfoygrbhtfo2jsLtqfIrDzdWDk6CyvsdvgI6cqrTJ09qJmKTDztV8jJm/ytK8x8+6xs66xc5vgI+9ydHBzNN3iJWNnKe3wstneYjG0dhyg5GJmaWotL5sfoyHl6PI0tqap7Jpe4mNnKhneIeIl6OKmaWRoKtrfIuhrrigrrh2h5S1wMm0wMmOnaiFlaFoeomntL5rfYuToq3Ez9aqt8CQn6t6ipezv8icqrWIl6R2hpR1hpTI09qms72WpK+HlqN3h5VpeonCzdSRn6uFlKF6i5h6iphwgY+9yNC7x8+qt8GfrbefrLeElKB+jpt9jZqdq7Wksbu4xMy4w8yCkp+SoKyir7qir7nF0NfFz9eerLa1wcrK1dyHlqKruMGcqbR1hpOxvcawvMWPnanH0dl7i5nI0tl5ipeuusNtf42otb9ugI6QnqqWpLBoeohqe4qUo66bqbOGlqKToa14iJZpe4qvu8R5iZe8x9C5xc25xM3Ez9fCzdW3w8yVpK+qtsCdqrWVo66RoKyUoq62wsqOnamjsLqtucO7xs/Ezta2wsuuusSPnqmvvMWCkZ6SoayptsCVo692ayFsAAAIy0lEQVR4AezBMQEAAAQAMKB/ZbcO2+IDAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAALJ69tiDBzMJojAIgH1ra/61bdv5Z3UJrGYePnVVKByJxmLxRCIei0Uj4VAw4PclQZal0plszpE3nFw2k06B7MgXiiX5QalYyMMwKmei4kK0UoYxVK3VxbVcrQoDqNFsiUetZgOkV7vTFQXdThukT68/EEWDfg+kx99wJBqMhn8gDfw50STnB6nKh0WjcB6kZDwRrSZjkHfTmWg3m4I8mi/EgMUc5MnSESOcJci91VqMWa9ALm22YtB2A3JlFxOjYjuQC/uuGNbdg352iItx8SPoR/u4WHA6g35y6YoVpQvoB72rWHLtgb76a4k1rT/QNzex6Ab6YixWjUEf3R9i1eMO+uD5z9496Ia2hUEAnmt7jo3g2lZt2zi2att959qI0zXJP98r7L38I4MnLOMm7HiZPHGZsGNlMYEsHMO+zmYC2V/jaJbDJHJwJPuEiXyCI1juWSaS8QMOs7eYTB4OsVP5TCb/FA6yAib0D+yAXwuZUOGvsP1ymFQRbJ/XmdjrsL3OMLFi2B6/FDKxwl9gu0qYXAlsx7VSJvfVNWyzMgooxzaroIAK2JZKSqiCbaqmhGrYhtxSSijNRTJ+Sffr+vFqKKIGtub/Woqo/R+A1VFGHQDLoYwcwF6rp4z612DfUsi3sAYKaYC9RyHv+Xs0UskXjYiuiVKaEF0zpTQjuhYq8SKSW0gphbmIrZViWhFbG8W0IbZ2imlHbB0U04nQbn1BMV/cQmT/Us6/iOw25dxGZHco5w4iu0s5dxHZPcq5h8juU859BPaAgh44ylpLpYNIVTig9HsK+h5xPaQUPxo+oqBHiOsxBT1BXBkU9BRx1VJQ4WVEdZOSfkJUzyjpuUNONDgE/gUlvUBUpynpNKJ6SUmvEFUeJV108pSWBtc40VLtbiEa3FGki5K+QVTf+IMI8AfR1U1J3Yiqh5J6/EH8QfxB/EG8hgjwLkuYP4i+R5T0yE1DtJxxkwoNblxxnpLOI6peSupFVH2U1Ieo3qCkNxBVPyUNIKqfKOlrhPUfBf3n/BAtGYhrkIIGEdcQBQ0hrmEKGnFnBKeHqBiloDEE9jnlfI7IfqScHxHZOOWMI7JzlDOByC5nU8xXkwhtimI+Q2zDPhZq+Zhi/kJwP1PKz4hu3JteLae+oJAvfoESv4kMwqYp5Aps8ill/DEJ2AxlzACw/+spov4m1th5rShrG8umhOwxbLCXWoXL7LVZCrj0GrbYHAXMY4ctMLkF7LLFDCaWsYg9rPI/JvVFFfaxciZ1HaaUtF6Mg+y1q0zm6ms4xHKXmMjS8io79aAcVwCFAfjEHCVnHefGySg2RrXtNrbu1o1t29Y71ubiarr/9xAfwW+0jbIqRtsJfksQWQVWgeAPnpSz4sqf0J+BFyvMK4zgb8bGWUHjYwT/UPWSFfOyiuDfJiZZEZMTZBMQ7haw7AqmBLIVZD9kmT3MJrCHu6GAZVNgcCewl246i2WRNa0jR4BbuM8MS2zmWrgbOQyE0ppZlsxsTalA4CS3/rnh0+y008Nz/W4kDYgcmF8wssOMC/MDkQQSEy4nLF5bWmY7LC9dW0y4LBDIqC1jRf/glqHGd9U/IJB/ERjgv+pbY7j1QL+S0U6guJG299IslrS290YIAAAAAAAAAAAAAAAAAAAAAAAA4P/wZC2lpNk8VZwcId6798jf//G9e2JEcvGUubkkZe0JgWLc1kumH9bF8l/F1j2cLtlwI5DV5krMmUun2WanL52JWdkkkEP6M0MQOyTI8CydpARbpYZ6dkq9oXSLJAHrXrUsiVqvdXISbJeFsoRCy7bJYZC+48+S899JJwdApF5kmVj1kWQfMHnPsoxmvU0ENuvatbLsrLtdBLYQ9opYEcY9gf4FkvYTWTGJ+0n0N7D1qpIVVXmwRX8Ct+cqWXGVh7fpd8At6iar4maUG/0CJopYNcYJ+hEcDbOqajvpG2gbDGaVBR+30WdQGsAaMF5KH8CayBohrhGEtVSyZlS2hJGLSxNZU8Q0cmnPzrPGJJ6Q6xKusQZdE8hFmYpYk4pM5JI6ZlijCjrQlcrQVmMfa9i79u4BPc8oCKBwbX731LZt27Zt27Zt2/b2uoEyHL1bOMHNzDz54fgGXz3ejUO41pU99dieEC8993PDMBIVRjq5gmi0GyV2uzjfanMONc61cTC8ylAkMz/aet8TVXq+t91jZ0uUabnT9PSqAurM6Ge4xwxQWKRW9CgIUaTbBZS6YHKwVa0JajUx+Pr9kKFY9sHc+qMPqvUxtiAp2hDlGhY1FWQM6o2x1KM2Blyx02M6Jky30uPjVUy4+trIg7cJRjQx8fitXwYzyli4xX6BIdf199iIKRu996gzDlPG9VJ+8XMGY84Ujb8IZamtuce8hDlpnuIR70AMGqh38FsDSWLM+AmjPunscboJRjU5rTLIZ8z6rPKFhWEKX1oV62FYvYrqghzDtGPaelS6hmnXKikLMgjjBsVvdGHmqdoS9sG85Zq2h9VxoLqiJ+9AHBio5+m7GRcOaukxoCUutBygJEhJnCipo8eB1jjR+kDs0f9b7NebzsCNGRq2uTdwpJn8Hosv4cilxeKDtMKVfeKDTMSVTPpE6wTOfBEeZDXOfJXdo2vCm/Wig7zCnW+i5+4VcKdCR8FBvuPQRcFBduPQbrk9KiUcSpXiOO7fxNHccVw6LrVHLZyqJTTID5z6ITRIPZyqJ7PHQ9x6GLt0WaqIDLIItxZJ7LEeUWLk2wLHWggM0hbH2gqcvN/BsTsVY5kuy4nYFcoyU1yQe7hWVlqP/QnX0n5hQd7h3Lv4Z7CyvBAWZCvObZXV4/AInBtxWFSQJ4gSa8NWEaSVqCBvIsgUUUHWRpC1knrUXxFBVtQXFOQ+gfvxmRTxSRa/0wFR4qJ0JIGRMTiJ4cnvrCOwTk6PYQRgmJggDwjAgyJ54CdHF8F5TMtp0wAAAABJRU5ErkJggg=="
-
-	// Decode the hardcoded default profile picture
-	defaultPFP, err := base64.StdEncoding.DecodeString(defaultProfilePictureBase64)
-	if err != nil {
-		defaultPFP = []byte{}
-	}
-
 	// Create a hashed password for sample users
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.DefaultCost)
 	if err != nil {
@@ -182,11 +686,11 @@ func TempData() {
 
 	for _, u := range sampleUsers {
 		_, err := DB.Exec(
-			`INSERT INTO users (username, email, password, display_name, profile_picture)
-            VALUES ($1, $2, $3, $4, $5)
+			`INSERT INTO users (username, email, password, display_name, profile_picture, email_verified_at)
+            VALUES ($1, $2, $3, $4, $5, NOW())
             ON CONFLICT (username) DO UPDATE 
-            SET email = $2, password = $3, display_name = $4, profile_picture = $5`,
-			u.username, u.email, string(hashedPassword), u.displayName, defaultPFP,
+            SET email = $2, password = $3, display_name = $4, profile_picture = $5, email_verified_at = NOW()`,
+			u.username, u.email, string(hashedPassword), u.displayName, assets.DefaultAvatar,
 		)
 		if err != nil {
 			log.Println("Error inserting user", u.username, ":", err)
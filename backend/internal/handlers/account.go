@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BenH9999/CampusConnect/backend/internal/account"
+	"github.com/BenH9999/CampusConnect/backend/internal/auth"
+	"github.com/BenH9999/CampusConnect/backend/internal/db"
+	"github.com/BenH9999/CampusConnect/backend/internal/mailer"
+	"github.com/BenH9999/CampusConnect/backend/internal/validation"
+)
+
+// recentSignInWindow is how long after signing in an SSO user, who has no
+// password to confirm with, can still delete their account
+const recentSignInWindow = 10 * time.Minute
+
+type DeleteAccountInput struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+// RequestDataExport queues a ZIP of the caller's data to be built in the background
+func RequestDataExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	export, err := account.RequestExport(auth.CurrentUser(r))
+	if err != nil {
+		if errors.Is(err, account.ErrExportInProgress) {
+			http.Error(w, "An export is already being prepared", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Failed to request export", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(export)
+}
+
+// GetDataExports lists the caller's exports and their status
+func GetDataExports(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	exports, err := account.ListExports(auth.CurrentUser(r))
+	if err != nil {
+		http.Error(w, "Failed to fetch exports", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(exports)
+}
+
+// DownloadDataExport serves a finished export archive
+func DownloadDataExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Invalid export ID", http.StatusBadRequest)
+		return
+	}
+
+	username := auth.CurrentUser(r)
+	archive, completedAt, err := account.ExportArchive(username, id)
+	if err != nil {
+		if errors.Is(err, account.ErrExportNotFound) {
+			http.Error(w, "Export not found or has expired", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to fetch export", http.StatusInternalServerError)
+		return
+	}
+
+	filename := "campusconnect-" + username + "-" + completedAt.UTC().Format("20060102") + ".zip"
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.Header().Set("Cache-Control", "private, no-store")
+	http.ServeContent(w, r, filename, completedAt, bytes.NewReader(archive))
+}
+
+// GetAccountDeletion reports whether the caller's account is scheduled for deletion
+func GetAccountDeletion(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var scheduledFor *time.Time
+	err := db.DB.QueryRow(`SELECT deletion_scheduled_for FROM users WHERE username = $1`, auth.CurrentUser(r)).Scan(&scheduledFor)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"scheduled":              scheduledFor != nil,
+		"deletion_scheduled_for": scheduledFor,
+	})
+}
+
+// DeleteAccount schedules the caller's account for deletion after the grace
+// period. Other sessions are signed out; the current one stays so the user
+// can still cancel.
+//
+// It has to be confirmed with the password, plus a code with 2FA on. SSO
+// accounts never chose a password, so they can confirm with just a code, or
+// without 2FA by having signed in within recentSignInWindow.
+func DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input DeleteAccountInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	username := auth.CurrentUser(r)
+
+	var email string
+	var twoFactor, sso bool
+	err := db.DB.QueryRow(`
+		SELECT email, totp_enabled_at IS NOT NULL, oidc_subject IS NOT NULL FROM users WHERE username = $1
+	`, username).Scan(&email, &twoFactor, &sso)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if input.Password == "" && !sso {
+		http.Error(w, "password is required", http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case twoFactor:
+		if input.Code == "" {
+			http.Error(w, "code is required when two-factor authentication is enabled", http.StatusBadRequest)
+			return
+		}
+		if !checkSecondFactor(w, username, input.Code, input.Password) {
+			return
+		}
+	case input.Password == "":
+		recent, err := auth.SessionStartedWithin(auth.CurrentSession(r), recentSignInWindow)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if !recent {
+			http.Error(w, "Sign in again with single sign-on, or reset your password, to delete your account", http.StatusForbidden)
+			return
+		}
+	default:
+		ok, err := auth.CheckPassword(username, input.Password)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(w, "Password is incorrect", http.StatusForbidden)
+			return
+		}
+	}
+
+	scheduledFor, err := account.ScheduleDeletion(username)
+	if err != nil {
+		if errors.Is(err, account.ErrDeletionAlreadyScheduled) {
+			http.Error(w, "Account deletion is already scheduled", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Failed to schedule account deletion", http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := auth.RevokeAllSessions(username, auth.CurrentSession(r)); err != nil {
+		log.Println("Error revoking sessions for deleted account:", err)
+	}
+
+	err = mailer.Send(mailer.Message{
+		To:      email,
+		Subject: "Your CampusConnect account will be deleted",
+		Body: "Hi " + username + ",\n\n" +
+			"Your CampusConnect account and everything in it will be permanently deleted on " +
+			scheduledFor.UTC().Format("2 January 2006 at 15:04 MST") + ".\n\n" +
+			"If you change your mind, sign in to the app before then and cancel the deletion. " +
+			"If you didn't ask for this, sign in, cancel it and change your password.\n",
+	})
+	if err != nil {
+		log.Println("Error sending account deletion email:", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"success":                true,
+		"deletion_scheduled_for": scheduledFor,
+	})
+}
+
+// CancelAccountDeletion keeps an account that was scheduled for deletion
+func CancelAccountDeletion(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := account.CancelDeletion(auth.CurrentUser(r)); err != nil {
+		if errors.Is(err, account.ErrDeletionNotScheduled) {
+			http.Error(w, "Account deletion is not scheduled", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Failed to cancel account deletion", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
+
+type ChangeUsernameInput struct {
+	Username string `json:"username"`
+}
+
+// ChangeUsername renames the caller's account. The old name keeps working
+// as a redirect to the profile.
+func ChangeUsername(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input ChangeUsernameInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	newUsername := strings.TrimSpace(input.Username)
+	var errs validation.Errors
+	errs.Username("username", newUsername)
+	if errs.Any() {
+		writeValidationErrors(w, errs)
+		return
+	}
+
+	err := account.ChangeUsername(auth.CurrentUser(r), newUsername)
+	if err != nil {
+		switch {
+		case errors.Is(err, account.ErrUsernameUnchanged):
+			http.Error(w, "That is already your username", http.StatusBadRequest)
+		case errors.Is(err, account.ErrUsernameTaken):
+			errs.Add("username", validation.CodeTaken, "Username is already taken")
+			writeConflict(w, errs)
+		case errors.Is(err, account.ErrUsernameReserved):
+			errs.Add("username", validation.CodeTaken, "Username was recently used by another account and isn't available yet")
+			writeConflict(w, errs)
+		case errors.Is(err, account.ErrConfiguredUsername):
+			http.Error(w, "Accounts listed in ADMIN_USERNAMES can't be renamed", http.StatusConflict)
+		default:
+			if _, ok := uniqueViolation(err); ok {
+				errs.Add("username", validation.CodeTaken, "Username is already taken")
+				writeConflict(w, errs)
+				return
+			}
+			http.Error(w, "Failed to change username", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"username": newUsername})
+}
@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/BenH9999/CampusConnect/backend/internal/auth"
+	"github.com/BenH9999/CampusConnect/backend/internal/config"
+	"github.com/BenH9999/CampusConnect/backend/internal/db"
+	"github.com/BenH9999/CampusConnect/backend/internal/models"
+	"github.com/BenH9999/CampusConnect/backend/internal/throttle"
+	"github.com/BenH9999/CampusConnect/backend/internal/utils"
+)
+
+type EmailDomainInput struct {
+	Domain      string             `json:"domain"`
+	Affiliation models.Affiliation `json:"affiliation"`
+}
+
+// GetEmailDomains lists every email domain allowed to register
+func GetEmailDomains(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	domains, err := utils.ListEmailDomains()
+	if err != nil {
+		http.Error(w, "Failed to fetch email domains", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(domains)
+}
+
+// AddEmailDomain allows a new email domain to register, or changes the
+// affiliation of one that was added before
+func AddEmailDomain(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input EmailDomainInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	domain := strings.ToLower(strings.TrimSpace(input.Domain))
+	if domain == "" || strings.ContainsAny(domain, "@ ") || !strings.Contains(domain, ".") || len(domain) > 100 {
+		http.Error(w, "A valid domain is required", http.StatusBadRequest)
+		return
+	}
+
+	if !input.Affiliation.Valid() {
+		http.Error(w, "affiliation must be student, staff or alumni", http.StatusBadRequest)
+		return
+	}
+
+	_, err := db.DB.Exec(`
+		INSERT INTO allowed_email_domains (domain, affiliation, added_by)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (domain) DO UPDATE SET affiliation = $2, added_by = $3
+	`, domain, input.Affiliation, auth.CurrentUser(r))
+	if err != nil {
+		http.Error(w, "Failed to add email domain", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(models.EmailDomain{Domain: domain, Affiliation: input.Affiliation, Source: "admin", AddedBy: auth.CurrentUser(r)})
+}
+
+// RemoveEmailDomain removes a domain added at runtime. Domains from
+// ALLOWED_EMAIL_DOMAINS can only be removed by changing the config.
+func RemoveEmailDomain(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input EmailDomainInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Domain == "" {
+		http.Error(w, "domain is required", http.StatusBadRequest)
+		return
+	}
+
+	domain := strings.ToLower(strings.TrimSpace(input.Domain))
+	result, err := db.DB.Exec(`DELETE FROM allowed_email_domains WHERE domain = $1`, domain)
+	if err != nil {
+		http.Error(w, "Failed to remove email domain", http.StatusInternalServerError)
+		return
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		if slices.Contains(config.GetAllowedEmailDomains(), domain) {
+			http.Error(w, "Domain is set in ALLOWED_EMAIL_DOMAINS and can't be removed at runtime", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Domain not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
+
+type ClearLockoutInput struct {
+	Key string `json:"key"`
+}
+
+// GetLoginLockouts lists accounts and IPs currently delayed or locked out after failed logins
+func GetLoginLockouts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	blocked, err := throttle.Login.Blocked()
+	if err != nil {
+		http.Error(w, "Failed to fetch lockouts", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(blocked)
+}
+
+// ClearLoginLockout lifts the delay or lockout on a key such as "account:alice@example.com"
+func ClearLoginLockout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input ClearLockoutInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Key == "" {
+		http.Error(w, "key is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := throttle.Login.Reset(input.Key); err != nil {
+		http.Error(w, "Failed to clear lockout", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
+
+type RoleInput struct {
+	Username string      `json:"username"`
+	Role     models.Role `json:"role"`
+}
+
+// GetRoleGrants lists every admin, moderator and staff role held
+func GetRoleGrants(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	grants, err := auth.ListRoleGrants()
+	if err != nil {
+		http.Error(w, "Failed to fetch roles", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(grants)
+}
+
+// GrantRole gives a user a role
+func GrantRole(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input RoleInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Username == "" || input.Role == "" {
+		http.Error(w, "username and role are required", http.StatusBadRequest)
+		return
+	}
+
+	if err := auth.GrantRole(input.Username, input.Role, auth.CurrentUser(r)); err != nil {
+		writeRoleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
+
+// RevokeRole takes a role away from a user. Admins can't revoke their own
+// admin role, so there is always someone left who can manage roles.
+func RevokeRole(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input RoleInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Username == "" || input.Role == "" {
+		http.Error(w, "username and role are required", http.StatusBadRequest)
+		return
+	}
+
+	if input.Role == models.RoleAdmin && input.Username == auth.CurrentUser(r) {
+		http.Error(w, "You can't revoke your own admin role", http.StatusConflict)
+		return
+	}
+
+	if err := auth.RevokeRole(input.Username, input.Role); err != nil {
+		writeRoleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
+
+func writeRoleError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, auth.ErrUnknownRole):
+		http.Error(w, "role must be admin, moderator, staff or student", http.StatusBadRequest)
+	case errors.Is(err, auth.ErrBaseRole):
+		http.Error(w, "Every account has the student role", http.StatusBadRequest)
+	case errors.Is(err, auth.ErrConfiguredRole):
+		http.Error(w, "User is set in ADMIN_USERNAMES and can't lose the admin role at runtime", http.StatusConflict)
+	case errors.Is(err, auth.ErrRoleUserNotFound):
+		http.Error(w, "User not found", http.StatusNotFound)
+	case errors.Is(err, auth.ErrRoleNotGranted):
+		http.Error(w, "User does not have that role", http.StatusNotFound)
+	default:
+		http.Error(w, "Failed to update roles", http.StatusInternalServerError)
+	}
+}
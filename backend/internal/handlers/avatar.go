@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/BenH9999/CampusConnect/backend/internal/account"
+	"github.com/BenH9999/CampusConnect/backend/internal/avatar"
+)
+
+// GetAvatar serves /api/users/{username}/avatar, resized to ?size= (48, 128
+// or 400). URLs carrying the current ?v= version never change and are cached
+// for a year; without it clients revalidate with the ETag.
+func GetAvatar(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	username := r.PathValue("username")
+	size := avatar.SizeMedium
+	if s := r.URL.Query().Get("size"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			http.Error(w, "Invalid size", http.StatusBadRequest)
+			return
+		}
+		size = avatar.NormalizeSize(n)
+	}
+
+	img, err := avatar.Variant(username, size)
+	if err != nil {
+		if errors.Is(err, avatar.ErrNotFound) {
+			redirectRenamedAvatar(w, r, username)
+			return
+		}
+		http.Error(w, "Failed to load avatar", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", img.ContentType)
+	w.Header().Set("ETag", `"`+img.Version+"-"+strconv.Itoa(size)+`"`)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if r.URL.Query().Get("v") == img.Version {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=300, must-revalidate")
+	}
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(img.Data))
+}
+
+// redirectRenamedAvatar follows a rename the same way profile lookups do
+func redirectRenamedAvatar(w http.ResponseWriter, r *http.Request, username string) {
+	current, err := account.ResolveUsername(username)
+	if err != nil {
+		http.Error(w, "Failed to load avatar", http.StatusInternalServerError)
+		return
+	}
+	if current == "" {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	query.Del("v")
+	target := "/api/users/" + url.PathEscape(current) + "/avatar"
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BenH9999/CampusConnect/backend/internal/auth"
+	"github.com/BenH9999/CampusConnect/backend/internal/avatar"
+	"github.com/BenH9999/CampusConnect/backend/internal/db"
+	"github.com/BenH9999/CampusConnect/backend/internal/visibility"
+)
+
+type BookmarkRequest struct {
+	PostID int `json:"post_id"`
+}
+
+type BookmarkItem struct {
+	PostFeedItem
+	// BookmarkID is what to pass as ?before= to get the next page
+	BookmarkID   int       `json:"bookmark_id"`
+	BookmarkedAt time.Time `json:"bookmarked_at"`
+}
+
+// SaveBookmark adds a post to the caller's bookmarks. Nobody else can see
+// who bookmarked what, not even the post's author.
+func SaveBookmark(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req BookmarkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.PostID == 0 {
+		http.Error(w, "post_id is required", http.StatusBadRequest)
+		return
+	}
+	if !requireVisiblePost(w, r, req.PostID) {
+		return
+	}
+
+	_, err := db.DB.Exec(`
+		INSERT INTO bookmarks (username, post_id) VALUES ($1, $2)
+		ON CONFLICT (username, post_id) DO NOTHING
+	`, auth.CurrentUser(r), req.PostID)
+	if err != nil {
+		http.Error(w, "Failed to save bookmark", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"is_bookmarked": true})
+}
+
+// RemoveBookmark takes a post out of the caller's bookmarks. It works even
+// if the post can no longer be seen, so hidden posts can be cleared out.
+func RemoveBookmark(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req BookmarkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.PostID == 0 {
+		http.Error(w, "post_id is required", http.StatusBadRequest)
+		return
+	}
+
+	_, err := db.DB.Exec(`DELETE FROM bookmarks WHERE username = $1 AND post_id = $2`, auth.CurrentUser(r), req.PostID)
+	if err != nil {
+		http.Error(w, "Failed to remove bookmark", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"is_bookmarked": false})
+}
+
+// GetBookmarks returns the caller's bookmarked posts, most recently saved
+// first. Posts they can no longer see are left out.
+func GetBookmarks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	before, limit, ok := pageParams(r)
+	if !ok {
+		http.Error(w, "Invalid before or limit parameter", http.StatusBadRequest)
+		return
+	}
+	viewer := auth.CurrentUser(r)
+
+	rows, err := db.DB.Query(`
+		SELECT
+			b.id,
+			b.created_at,
+			p.id,
+			p.username,
+			u.display_name,
+			u.avatar_version,
+			p.content,
+			p.created_at,
+			p.edited_at,
+			(SELECT COUNT(*) FROM likes l WHERE l.post_id = p.id) AS likes_count,
+			(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id) AS comments_count,
+			(SELECT COUNT(*) FROM reposts rp WHERE rp.post_id = p.id) AS reposts_count,
+			p.quoted_post_id,
+			p.visibility
+		FROM bookmarks b
+		JOIN posts p ON p.id = b.post_id
+		JOIN users u ON p.username = u.username
+		WHERE b.username = $1 AND ($2 = 0 OR b.id < $2) AND p.published AND `+visibility.Clause("p", "$1")+`
+		ORDER BY b.id DESC
+		LIMIT $3
+	`, viewer, before, limit)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var bookmarkIDs []int
+	var bookmarkedAt []time.Time
+	posts := []PostFeedItem{}
+	for rows.Next() {
+		var id int
+		var at time.Time
+		var item PostFeedItem
+		var avatarVersion string
+		err := rows.Scan(&id, &at, &item.ID, &item.Username, &item.DisplayName, &avatarVersion, &item.Content, &item.CreatedAt, &item.EditedAt,
+			&item.LikesCount, &item.CommentsCount, &item.RepostsCount, &item.QuotedPostID, &item.Visibility)
+		if err != nil {
+			http.Error(w, "Error scanning row", http.StatusInternalServerError)
+			return
+		}
+		item.ProfilePicture = avatar.URL(item.Username, avatarVersion, avatar.SizeMedium)
+		posts = append(posts, item)
+		bookmarkIDs = append(bookmarkIDs, id)
+		bookmarkedAt = append(bookmarkedAt, at)
+	}
+
+	if err := loadFeedExtras(posts, viewer); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	bookmarks := make([]BookmarkItem, len(posts))
+	for i := range posts {
+		bookmarks[i] = BookmarkItem{PostFeedItem: posts[i], BookmarkID: bookmarkIDs[i], BookmarkedAt: bookmarkedAt[i]}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(bookmarks)
+}
+
+// bookmarkedPosts returns which of the posts viewer has bookmarked
+func bookmarkedPosts(postIDs []int, viewer string) (map[int]bool, error) {
+	bookmarked := make(map[int]bool)
+	if len(postIDs) == 0 || viewer == "" {
+		return bookmarked, nil
+	}
+
+	ids := make([]string, len(postIDs))
+	for i, id := range postIDs {
+		ids[i] = strconv.Itoa(id)
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT post_id FROM bookmarks
+		WHERE username = $1 AND post_id = ANY(string_to_array($2, ',')::int[])
+	`, viewer, strings.Join(ids, ","))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		bookmarked[id] = true
+	}
+	return bookmarked, rows.Err()
+}
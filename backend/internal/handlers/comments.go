@@ -5,14 +5,16 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/BenH9999/CampusConnect/backend/internal/auth"
 	"github.com/BenH9999/CampusConnect/backend/internal/db"
+	"github.com/BenH9999/CampusConnect/backend/internal/mentions"
+	"github.com/BenH9999/CampusConnect/backend/internal/models"
 	"github.com/BenH9999/CampusConnect/backend/internal/utils"
 )
 
 type CreateCommentInput struct {
-	PostID   int    `json:"post_id"`
-	Username string `json:"username"`
-	Content  string `json:"content"`
+	PostID  int    `json:"post_id"`
+	Content string `json:"content"`
 }
 
 type CommentResponse struct {
@@ -21,6 +23,8 @@ type CommentResponse struct {
 	Username  string    `json:"username"`
 	Content   string    `json:"content"`
 	CreatedAt time.Time `json:"created_at"`
+
+	Mentions []models.Mention `json:"mentions"`
 }
 
 func CreateComment(w http.ResponseWriter, r *http.Request) {
@@ -31,29 +35,63 @@ func CreateComment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if input.PostID == 0 || input.Username == "" || input.Content == "" {
+	if input.PostID == 0 || input.Content == "" {
 		http.Error(w, "missing required fields", http.StatusBadRequest)
 		return
 	}
 
+	if !requireVisiblePost(w, r, input.PostID) {
+		return
+	}
+
+	username := auth.CurrentUser(r)
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
 	query := `INSERT INTO comments (post_id, username, content, created_at) VALUES ($1, $2, $3, NOW()) RETURNING id, created_at`
 	var id int
 	var createdAt time.Time
-	err = db.DB.QueryRow(query, input.PostID, input.Username, input.Content).Scan(&id, &createdAt)
+	err = tx.QueryRow(query, input.PostID, username, input.Content).Scan(&id, &createdAt)
+	if err != nil {
+		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	mentioned, err := mentions.Save(tx, nil, &id, input.Content)
 	if err != nil {
+		http.Error(w, "Failed to save mentions", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
 		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	// Create notification for post owner
-	utils.CreateCommentNotification(input.PostID, input.Username)
+	utils.CreateCommentNotification(input.PostID, username)
+	for _, m := range mentioned {
+		utils.CreateMentionNotification(m, username, input.PostID, &id)
+	}
+
+	commentMentions, err := mentions.ForComments([]int{id})
+	if err != nil {
+		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	response := CommentResponse{
 		ID:        id,
 		PostID:    input.PostID,
-		Username:  input.Username,
+		Username:  username,
 		Content:   input.Content,
 		CreatedAt: createdAt,
+		Mentions:  withoutNil(commentMentions[id]),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
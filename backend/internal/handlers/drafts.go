@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/BenH9999/CampusConnect/backend/internal/auth"
+	"github.com/BenH9999/CampusConnect/backend/internal/db"
+	"github.com/BenH9999/CampusConnect/backend/internal/media"
+	"github.com/BenH9999/CampusConnect/backend/internal/mentions"
+	"github.com/BenH9999/CampusConnect/backend/internal/middleware"
+	"github.com/BenH9999/CampusConnect/backend/internal/polls"
+	"github.com/BenH9999/CampusConnect/backend/internal/publish"
+)
+
+type PublishPostInput struct {
+	ID int `json:"id"`
+}
+
+type SchedulePostInput struct {
+	ID int `json:"id"`
+	// PublishAt of null turns a scheduled post back into a draft
+	PublishAt *time.Time `json:"publish_at"`
+}
+
+// GetDrafts lists the caller's drafts and scheduled posts, soonest to be
+// published first and then newest drafts
+func GetDrafts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT id, username, content, created_at, quoted_post_id, visibility, publish_at
+		FROM posts
+		WHERE username = $1 AND NOT published
+		ORDER BY publish_at ASC NULLS LAST, created_at DESC
+	`, auth.CurrentUser(r))
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	drafts := []PostResponse{}
+	for rows.Next() {
+		var post PostResponse
+		if err := rows.Scan(&post.ID, &post.Username, &post.Content, &post.CreatedAt, &post.QuotedPostID, &post.Visibility, &post.PublishAt); err != nil {
+			http.Error(w, "Error scanning post", http.StatusInternalServerError)
+			return
+		}
+		drafts = append(drafts, post)
+	}
+
+	ids := make([]int, len(drafts))
+	var quotedIDs []int
+	for i := range drafts {
+		ids[i] = drafts[i].ID
+		if drafts[i].QuotedPostID != nil {
+			quotedIDs = append(quotedIDs, *drafts[i].QuotedPostID)
+		}
+	}
+	attachments, err := media.ForPosts(ids)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	postMentions, err := mentions.ForPosts(ids)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	quoted, err := quotedPosts(quotedIDs, auth.CurrentUser(r))
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	draftPolls, err := polls.ForPosts(ids, auth.CurrentUser(r))
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	for i := range drafts {
+		drafts[i].Attachments = withoutNil(attachments[drafts[i].ID])
+		drafts[i].Mentions = withoutNil(postMentions[drafts[i].ID])
+		drafts[i].Poll = draftPolls[drafts[i].ID]
+		if drafts[i].QuotedPostID != nil {
+			drafts[i].QuotedPost = quoted[*drafts[i].QuotedPostID]
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(drafts)
+}
+
+// PublishPost publishes one of the caller's drafts or scheduled posts now
+func PublishPost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input PublishPostInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.ID == 0 {
+		http.Error(w, "id is required", http.StatusBadRequest)
+		return
+	}
+
+	if !requireOwnDraft(w, r, input.ID) {
+		return
+	}
+
+	if err := publish.Post(input.ID); err != nil {
+		if errors.Is(err, publish.ErrAlreadyPublished) {
+			http.Error(w, "Post is already published", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Failed to publish post", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
+
+// SchedulePost sets or clears when one of the caller's unpublished posts
+// goes out
+func SchedulePost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input SchedulePostInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.ID == 0 {
+		http.Error(w, "id is required", http.StatusBadRequest)
+		return
+	}
+	if input.PublishAt != nil && !input.PublishAt.After(time.Now()) {
+		http.Error(w, "publish_at must be in the future", http.StatusBadRequest)
+		return
+	}
+
+	if !requireOwnDraft(w, r, input.ID) {
+		return
+	}
+
+	// A poll shouldn't close before anyone can see it
+	if input.PublishAt != nil {
+		var closesAt *time.Time
+		err := db.DB.QueryRow(`SELECT closes_at FROM polls WHERE post_id = $1`, input.ID).Scan(&closesAt)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if closesAt != nil && !closesAt.After(*input.PublishAt) {
+			http.Error(w, "publish_at must be before the poll closes", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// The scheduler may have published it since the check above
+	res, err := db.DB.Exec(`UPDATE posts SET publish_at = $1 WHERE id = $2 AND NOT published`, input.PublishAt, input.ID)
+	if err != nil {
+		http.Error(w, "Failed to schedule post", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Post is already published", http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"success": true, "publish_at": input.PublishAt})
+}
+
+// requireOwnDraft writes an error response and returns false unless the post
+// is an unpublished post by the caller
+func requireOwnDraft(w http.ResponseWriter, r *http.Request, postID int) bool {
+	// Other people's drafts and hidden posts are as good as missing
+	if !requireVisiblePost(w, r, postID) {
+		return false
+	}
+
+	var author string
+	var published bool
+	err := db.DB.QueryRow(`SELECT username, published FROM posts WHERE id = $1`, postID).Scan(&author, &published)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Post not found", http.StatusNotFound)
+			return false
+		}
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return false
+	}
+
+	if author != auth.CurrentUser(r) {
+		middleware.Forbidden(w)
+		return false
+	}
+	if published {
+		http.Error(w, "Post is already published", http.StatusConflict)
+		return false
+	}
+	return true
+}
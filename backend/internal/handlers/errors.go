@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/BenH9999/CampusConnect/backend/internal/validation"
+)
+
+// pgUniqueViolation is the Postgres error code for a unique constraint failure
+const pgUniqueViolation = "23505"
+
+type errorResponse struct {
+	Error  string                  `json:"error"`
+	Fields []validation.FieldError `json:"fields,omitempty"`
+}
+
+// writeValidationErrors responds 400 with the per-field errors
+func writeValidationErrors(w http.ResponseWriter, errs validation.Errors) {
+	writeFieldErrors(w, http.StatusBadRequest, "validation_failed", errs)
+}
+
+// writeConflict responds 409 for a value that is already in use
+func writeConflict(w http.ResponseWriter, errs validation.Errors) {
+	writeFieldErrors(w, http.StatusConflict, "conflict", errs)
+}
+
+func writeFieldErrors(w http.ResponseWriter, status int, code string, errs validation.Errors) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorResponse{Error: code, Fields: errs})
+}
+
+// uniqueViolation returns the constraint name if err is a unique constraint failure
+func uniqueViolation(err error) (string, bool) {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation {
+		return pgErr.ConstraintName, true
+	}
+	return "", false
+}
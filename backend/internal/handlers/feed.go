@@ -1,48 +1,91 @@
 package handlers
 
 import (
-	"encoding/base64"
+	"database/sql"
 	"encoding/json"
 	"net/http"
 	"time"
 
+	"github.com/BenH9999/CampusConnect/backend/internal/auth"
+	"github.com/BenH9999/CampusConnect/backend/internal/avatar"
 	"github.com/BenH9999/CampusConnect/backend/internal/db"
+	"github.com/BenH9999/CampusConnect/backend/internal/linkpreview"
+	"github.com/BenH9999/CampusConnect/backend/internal/media"
+	"github.com/BenH9999/CampusConnect/backend/internal/models"
+	"github.com/BenH9999/CampusConnect/backend/internal/polls"
+	"github.com/BenH9999/CampusConnect/backend/internal/visibility"
 )
 
 type PostFeedItem struct {
-	ID             int       `json:"id"`
-	Username       string    `json:"username"`
-	DisplayName    string    `json:"display_name"`
-	ProfilePicture string    `json:"profile_picture"`
-	Content        string    `json:"content"`
-	CreatedAt      time.Time `json:"created_at"`
-	LikesCount     int       `json:"likes_count"`
-	CommentsCount  int       `json:"comments_count"`
+	ID             int        `json:"id"`
+	Username       string     `json:"username"`
+	DisplayName    string     `json:"display_name"`
+	ProfilePicture string     `json:"profile_picture"`
+	Content        string     `json:"content"`
+	CreatedAt      time.Time  `json:"created_at"`
+	EditedAt       *time.Time `json:"edited_at"`
+	LikesCount     int        `json:"likes_count"`
+	CommentsCount  int        `json:"comments_count"`
+	RepostsCount   int        `json:"reposts_count"`
+	QuotedPostID   *int       `json:"quoted_post_id"`
+
+	Visibility   models.Visibility `json:"visibility"`
+	IsBookmarked bool              `json:"is_bookmarked"`
+
+	Attachments []models.Attachment `json:"attachments"`
+	QuotedPost  *QuotedPost         `json:"quoted_post"`
+	Poll        *models.Poll        `json:"poll"`
+
+	LinkPreviews []models.LinkPreview `json:"link_previews"`
+	// RepostedBy is set when the post is in the feed because someone the
+	// user follows reposted it
+	RepostedBy *RepostInfo `json:"reposted_by"`
 }
 
+// GetFeed returns posts by the people the user follows and posts they
+// reposted, newest activity first. A post that arrives several ways appears
+// once, at its most recent post or repost.
 func GetFeed(w http.ResponseWriter, r *http.Request) {
-	currentUser := r.URL.Query().Get("username")
-	if currentUser == "" {
-		http.Error(w, "username query parameter is required", http.StatusBadRequest)
-		return
-	}
+	currentUser := auth.CurrentUser(r)
 
 	query := `
+	    WITH following AS (
+		    SELECT following FROM follows WHERE follower = $1
+	    ), entries AS (
+		    SELECT p.id AS post_id, NULL::VARCHAR AS reposted_by, p.created_at AS activity_at
+		    FROM posts p
+		    WHERE p.username IN (SELECT following FROM following) AND p.published
+		    UNION ALL
+		    SELECT rp.post_id, rp.username, rp.created_at
+		    FROM reposts rp
+		    WHERE rp.username IN (SELECT following FROM following)
+	    ), latest AS (
+		    SELECT DISTINCT ON (post_id) post_id, reposted_by, activity_at
+		    FROM entries
+		    ORDER BY post_id, activity_at DESC
+	    )
 	    SELECT 
 		    p.id,
 		    p.username,
 		    u.display_name,
-		    u.profile_picture,
+		    u.avatar_version,
 		    p.content,
 		    p.created_at,
+		    p.edited_at,
 		    (SELECT COUNT(*) FROM likes l WHERE l.post_id = p.id) AS likes_count,
-		    (SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id) AS comments_count
-	    FROM posts p
+		    (SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id) AS comments_count,
+		    (SELECT COUNT(*) FROM reposts rp WHERE rp.post_id = p.id) AS reposts_count,
+		    p.quoted_post_id,
+		    p.visibility,
+		    e.reposted_by,
+		    ru.display_name,
+		    e.activity_at
+	    FROM latest e
+	    JOIN posts p ON p.id = e.post_id
 	    JOIN users u ON p.username = u.username
-	    WHERE p.username IN (
-		    SELECT following FROM follows WHERE follower = $1
-	    )
-	    ORDER BY p.created_at DESC;
+	    LEFT JOIN users ru ON ru.username = e.reposted_by
+	    WHERE p.published AND ` + visibility.Clause("p", "$1") + `
+	    ORDER BY e.activity_at DESC;
 	`
 
 	rows, err := db.DB.Query(query, currentUser)
@@ -55,25 +98,79 @@ func GetFeed(w http.ResponseWriter, r *http.Request) {
 	var feed []PostFeedItem
 	for rows.Next() {
 		var item PostFeedItem
-		var profilePicture []byte
-		err := rows.Scan(&item.ID, &item.Username, &item.DisplayName, &profilePicture, &item.Content, &item.CreatedAt, &item.LikesCount, &item.CommentsCount)
+		var avatarVersion string
+		var repostedBy, reposterName sql.NullString
+		var activityAt time.Time
+		err := rows.Scan(&item.ID, &item.Username, &item.DisplayName, &avatarVersion, &item.Content, &item.CreatedAt, &item.EditedAt, &item.LikesCount, &item.CommentsCount,
+			&item.RepostsCount, &item.QuotedPostID, &item.Visibility, &repostedBy, &reposterName, &activityAt)
 		if err != nil {
 			http.Error(w, "Error scanning row: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
-
-		if len(profilePicture) > 0 {
-			encoded := base64.StdEncoding.EncodeToString(profilePicture)
-			item.ProfilePicture = "data:image/png;base64," + encoded
-		} else {
-			item.ProfilePicture = ""
+		item.ProfilePicture = avatar.URL(item.Username, avatarVersion, avatar.SizeMedium)
+		if repostedBy.Valid {
+			item.RepostedBy = &RepostInfo{
+				Username:    repostedBy.String,
+				DisplayName: reposterName.String,
+				RepostedAt:  activityAt,
+			}
 		}
 		feed = append(feed, item)
 	}
 
+	if err := loadFeedExtras(feed, currentUser); err != nil {
+		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	err = json.NewEncoder(w).Encode(feed)
 	if err != nil {
 		http.Error(w, "Error encoding response: "+err.Error(), http.StatusInternalServerError)
 	}
 }
+
+// loadFeedExtras fills in the attachments, quoted posts, polls, link
+// previews and bookmark flags of feed items
+func loadFeedExtras(feed []PostFeedItem, viewer string) error {
+	ids := make([]int, len(feed))
+	var quotedIDs []int
+	for i := range feed {
+		ids[i] = feed[i].ID
+		if feed[i].QuotedPostID != nil {
+			quotedIDs = append(quotedIDs, *feed[i].QuotedPostID)
+		}
+	}
+
+	attachments, err := media.ForPosts(ids)
+	if err != nil {
+		return err
+	}
+	quoted, err := quotedPosts(quotedIDs, viewer)
+	if err != nil {
+		return err
+	}
+	feedPolls, err := polls.ForPosts(ids, viewer)
+	if err != nil {
+		return err
+	}
+	previews, err := linkpreview.ForPosts(ids)
+	if err != nil {
+		return err
+	}
+	bookmarked, err := bookmarkedPosts(ids, viewer)
+	if err != nil {
+		return err
+	}
+
+	for i := range feed {
+		feed[i].Attachments = withoutNil(attachments[feed[i].ID])
+		feed[i].Poll = feedPolls[feed[i].ID]
+		feed[i].LinkPreviews = withoutNil(previews[feed[i].ID])
+		feed[i].IsBookmarked = bookmarked[feed[i].ID]
+		if feed[i].QuotedPostID != nil {
+			feed[i].QuotedPost = quoted[*feed[i].QuotedPostID]
+		}
+	}
+	return nil
+}
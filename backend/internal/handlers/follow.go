@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"github.com/BenH9999/CampusConnect/backend/internal/auth"
 	"github.com/BenH9999/CampusConnect/backend/internal/db"
 	"github.com/BenH9999/CampusConnect/backend/internal/utils"
 )
@@ -13,10 +14,10 @@ type FollowStatusResponse struct {
 }
 
 func GetFollowStatus(w http.ResponseWriter, r *http.Request) {
-	follower := r.URL.Query().Get("follower")
+	follower := auth.CurrentUser(r)
 	following := r.URL.Query().Get("following")
-	if follower == "" || following == "" {
-		http.Error(w, "Both 'follower' and 'following' query parameters are required", http.StatusBadRequest)
+	if following == "" {
+		http.Error(w, "'following' query parameter is required", http.StatusBadRequest)
 		return
 	}
 
@@ -37,7 +38,6 @@ func GetFollowStatus(w http.ResponseWriter, r *http.Request) {
 }
 
 type ToggleFollowRequest struct {
-	Follower  string `json:"follower"`
 	Following string `json:"following"`
 }
 
@@ -49,14 +49,20 @@ func ToggleFollow(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.Follower == "" || req.Following == "" {
-		http.Error(w, "Both 'follower' and 'following' are required", http.StatusBadRequest)
+	if req.Following == "" {
+		http.Error(w, "'following' is required", http.StatusBadRequest)
+		return
+	}
+
+	follower := auth.CurrentUser(r)
+	if follower == req.Following {
+		http.Error(w, "You cannot follow yourself", http.StatusBadRequest)
 		return
 	}
 
 	var count int
 	checkQuery := `SELECT COUNT(*) FROM follows WHERE follower = $1 AND following = $2`
-	err = db.DB.QueryRow(checkQuery, req.Follower, req.Following).Scan(&count)
+	err = db.DB.QueryRow(checkQuery, follower, req.Following).Scan(&count)
 	if err != nil {
 		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -64,25 +70,25 @@ func ToggleFollow(w http.ResponseWriter, r *http.Request) {
 
 	if count > 0 {
 		deleteQuery := `DELETE FROM follows WHERE follower = $1 AND following = $2`
-		_, err = db.DB.Exec(deleteQuery, req.Follower, req.Following)
+		_, err = db.DB.Exec(deleteQuery, follower, req.Following)
 		if err != nil {
 			http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
 	} else {
 		insertQuery := `INSERT INTO follows (follower, following) VALUES ($1, $2)`
-		_, err = db.DB.Exec(insertQuery, req.Follower, req.Following)
+		_, err = db.DB.Exec(insertQuery, follower, req.Following)
 		if err != nil {
 			http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
 
 		// Create a follow notification - only when a new follow happens, not on unfollow
-		utils.CreateFollowNotification(req.Following, req.Follower)
+		utils.CreateFollowNotification(req.Following, follower)
 	}
 
 	var newCount int
-	err = db.DB.QueryRow(checkQuery, req.Follower, req.Following).Scan(&newCount)
+	err = db.DB.QueryRow(checkQuery, follower, req.Following).Scan(&newCount)
 	if err != nil {
 		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/BenH9999/CampusConnect/backend/internal/auth"
+	"github.com/BenH9999/CampusConnect/backend/internal/avatar"
+	"github.com/BenH9999/CampusConnect/backend/internal/db"
+	"github.com/BenH9999/CampusConnect/backend/internal/hashtags"
+	"github.com/BenH9999/CampusConnect/backend/internal/visibility"
+)
+
+// GetTagPosts returns the posts using a tag, newest first. Scheduled posts
+// take the time they're published as their created_at, so pages follow
+// created_at rather than id, with the id breaking ties. To get the next page
+// pass the last post's id as ?before= and its created_at as
+// ?before_created_at=; both come from the client so paging still works if
+// that post has since been deleted.
+func GetTagPosts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	tag, ok := hashtags.Normalize(r.URL.Query().Get("tag"))
+	if !ok {
+		http.Error(w, "A valid tag parameter is required", http.StatusBadRequest)
+		return
+	}
+	before, limit, ok := pageParams(r)
+	if !ok {
+		http.Error(w, "Invalid before or limit parameter", http.StatusBadRequest)
+		return
+	}
+	var beforeCreatedAt time.Time
+	if before != 0 {
+		var err error
+		beforeCreatedAt, err = time.Parse(time.RFC3339Nano, r.URL.Query().Get("before_created_at"))
+		if err != nil {
+			http.Error(w, "before_created_at is required with before", http.StatusBadRequest)
+			return
+		}
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT
+			p.id,
+			p.username,
+			u.display_name,
+			u.avatar_version,
+			p.content,
+			p.created_at,
+			p.edited_at,
+			(SELECT COUNT(*) FROM likes l WHERE l.post_id = p.id) AS likes_count,
+			(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id) AS comments_count,
+			(SELECT COUNT(*) FROM reposts rp WHERE rp.post_id = p.id) AS reposts_count,
+			p.quoted_post_id,
+			p.visibility
+		FROM post_hashtags h
+		JOIN posts p ON p.id = h.post_id
+		JOIN users u ON p.username = u.username
+		WHERE h.tag = $1 AND p.published AND `+visibility.Clause("p", "$4")+`
+			AND ($2 = 0 OR (h.created_at, h.post_id) < ($5, $2))
+		ORDER BY h.created_at DESC, h.post_id DESC
+		LIMIT $3
+	`, tag, before, limit, auth.CurrentUser(r), beforeCreatedAt)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	posts := []PostFeedItem{}
+	for rows.Next() {
+		var item PostFeedItem
+		var avatarVersion string
+		err := rows.Scan(&item.ID, &item.Username, &item.DisplayName, &avatarVersion, &item.Content, &item.CreatedAt, &item.EditedAt, &item.LikesCount, &item.CommentsCount,
+			&item.RepostsCount, &item.QuotedPostID, &item.Visibility)
+		if err != nil {
+			http.Error(w, "Error scanning row", http.StatusInternalServerError)
+			return
+		}
+		item.ProfilePicture = avatar.URL(item.Username, avatarVersion, avatar.SizeMedium)
+		posts = append(posts, item)
+	}
+
+	if err := loadFeedExtras(posts, auth.CurrentUser(r)); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(posts)
+}
+
+// GetTrendingTags returns the tags trending right now. The list is worked
+// out in the background every few minutes, not per request.
+func GetTrendingTags(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	tags, err := hashtags.Trending()
+	if err != nil {
+		http.Error(w, "Failed to fetch trending tags", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tags)
+}
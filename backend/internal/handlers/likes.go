@@ -3,14 +3,15 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
 
+	"github.com/BenH9999/CampusConnect/backend/internal/auth"
 	"github.com/BenH9999/CampusConnect/backend/internal/db"
 	"github.com/BenH9999/CampusConnect/backend/internal/utils"
 )
 
 type ToggleLikeRequest struct {
-	PostID   int    `json:"post_id"`
-	Username string `json:"username"`
+	PostID int `json:"post_id"`
 }
 
 type LikeResponse struct {
@@ -25,17 +26,20 @@ func CheckLikeStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	postID := r.URL.Query().Get("post_id")
-	username := r.URL.Query().Get("username")
+	postID, err := strconv.Atoi(r.URL.Query().Get("post_id"))
+	username := auth.CurrentUser(r)
 
-	if postID == "" || username == "" {
-		http.Error(w, "post_id and username parameters are required", http.StatusBadRequest)
+	if err != nil {
+		http.Error(w, "post_id parameter is required", http.StatusBadRequest)
+		return
+	}
+	if !requireVisiblePost(w, r, postID) {
 		return
 	}
 
 	// Check if the user has already liked this post
 	var exists bool
-	err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM likes WHERE post_id = $1 AND username = $2)",
+	err = db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM likes WHERE post_id = $1 AND username = $2)",
 		postID, username).Scan(&exists)
 	if err != nil {
 		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
@@ -74,15 +78,20 @@ func ToggleLike(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.PostID == 0 || req.Username == "" {
-		http.Error(w, "PostID and Username are required", http.StatusBadRequest)
+	if req.PostID == 0 {
+		http.Error(w, "PostID is required", http.StatusBadRequest)
 		return
 	}
+	if !requireVisiblePost(w, r, req.PostID) {
+		return
+	}
+
+	username := auth.CurrentUser(r)
 
 	// Check if the user has already liked this post
 	var exists bool
 	err = db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM likes WHERE post_id = $1 AND username = $2)",
-		req.PostID, req.Username).Scan(&exists)
+		req.PostID, username).Scan(&exists)
 	if err != nil {
 		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -92,7 +101,7 @@ func ToggleLike(w http.ResponseWriter, r *http.Request) {
 	if exists {
 		// Unlike
 		_, err = db.DB.Exec("DELETE FROM likes WHERE post_id = $1 AND username = $2",
-			req.PostID, req.Username)
+			req.PostID, username)
 		if err != nil {
 			http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
 			return
@@ -100,14 +109,14 @@ func ToggleLike(w http.ResponseWriter, r *http.Request) {
 	} else {
 		// Like
 		_, err = db.DB.Exec("INSERT INTO likes (post_id, username, created_at) VALUES ($1, $2, NOW())",
-			req.PostID, req.Username)
+			req.PostID, username)
 		if err != nil {
 			http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
 
 		// Create notification when a post is liked (not when unliked)
-		utils.CreateLikeNotification(req.PostID, req.Username)
+		utils.CreateLikeNotification(req.PostID, username)
 	}
 
 	// Get updated like count
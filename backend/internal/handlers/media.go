@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/BenH9999/CampusConnect/backend/internal/auth"
+	"github.com/BenH9999/CampusConnect/backend/internal/config"
+	"github.com/BenH9999/CampusConnect/backend/internal/imaging"
+	"github.com/BenH9999/CampusConnect/backend/internal/media"
+)
+
+// UploadMedia stores a file sent as multipart/form-data in the "file" field,
+// with optional "alt_text". The returned ID can then be passed in
+// attachment_ids when creating a post.
+func UploadMedia(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	maxBytes := config.GetMaxUploadBytes()
+	// Leave room for the multipart framing and the alt text
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes+64<<10)
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		var tooBig *http.MaxBytesError
+		if errors.As(err, &tooBig) {
+			http.Error(w, "File is larger than "+strconv.FormatInt(maxBytes>>20, 10)+" MB", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "file is required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	if header.Size > maxBytes {
+		http.Error(w, "File is larger than "+strconv.FormatInt(maxBytes>>20, 10)+" MB", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		http.Error(w, "Failed to read upload", http.StatusBadRequest)
+		return
+	}
+
+	att, err := media.Save(auth.CurrentUser(r), data, r.FormValue("alt_text"))
+	if err != nil {
+		switch {
+		case errors.Is(err, media.ErrTooLarge):
+			http.Error(w, "File is larger than "+strconv.FormatInt(maxBytes>>20, 10)+" MB", http.StatusRequestEntityTooLarge)
+		case errors.Is(err, media.ErrUnsupportedType):
+			http.Error(w, "Only JPEG, PNG and GIF images and PDF files can be uploaded", http.StatusUnsupportedMediaType)
+		case errors.Is(err, media.ErrBadImage):
+			http.Error(w, "Image could not be read or is larger than "+strconv.Itoa(imaging.MaxDimension)+" pixels across", http.StatusBadRequest)
+		case errors.Is(err, media.ErrAltTextTooLong):
+			http.Error(w, "alt_text must be at most "+strconv.Itoa(media.AltTextMaxLength)+" characters", http.StatusBadRequest)
+		default:
+			http.Error(w, "Failed to store upload", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(att)
+}
+
+// GetMedia serves an attachment's file
+func GetMedia(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Invalid attachment ID", http.StatusBadRequest)
+		return
+	}
+
+	body, att, key, err := media.Open(id, auth.CurrentUser(r))
+	if err != nil {
+		if errors.Is(err, media.ErrNotFound) {
+			http.Error(w, "Attachment not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to fetch attachment", http.StatusInternalServerError)
+		return
+	}
+	defer body.Close()
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		http.Error(w, "Failed to fetch attachment", http.StatusInternalServerError)
+		return
+	}
+
+	// Stored files never change, so the key is a stable ETag
+	w.Header().Set("Content-Type", att.MimeType)
+	w.Header().Set("ETag", `"`+key+`"`)
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, "", att.CreatedAt, bytes.NewReader(data))
+}
+
+// withoutNil makes an empty list, such as a post with no attachments, encode
+// as [] rather than null
+func withoutNil[T any](items []T) []T {
+	if items == nil {
+		return []T{}
+	}
+	return items
+}
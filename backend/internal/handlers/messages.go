@@ -7,17 +7,16 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/BenH9999/CampusConnect/backend/internal/auth"
+	"github.com/BenH9999/CampusConnect/backend/internal/avatar"
 	"github.com/BenH9999/CampusConnect/backend/internal/db"
+	"github.com/BenH9999/CampusConnect/backend/internal/middleware"
 	"github.com/BenH9999/CampusConnect/backend/internal/models"
 )
 
 // GetConversations returns a list of all conversations for the user
 func GetConversations(w http.ResponseWriter, r *http.Request) {
-	username := r.URL.Query().Get("username")
-	if username == "" {
-		http.Error(w, "Username is required", http.StatusBadRequest)
-		return
-	}
+	username := auth.CurrentUser(r)
 
 	// Get all conversations for the user
 	rows, err := db.DB.Query(`
@@ -44,7 +43,7 @@ func GetConversations(w http.ResponseWriter, r *http.Request) {
 
 		// For each conversation, get the participants
 		participantRows, err := db.DB.Query(`
-			SELECT u.username, u.display_name, u.profile_picture
+			SELECT u.username, u.display_name, u.avatar_version
 			FROM conversation_participants cp
 			JOIN users u ON cp.username = u.username
 			WHERE cp.conversation_id = $1 AND cp.username != $2
@@ -57,11 +56,13 @@ func GetConversations(w http.ResponseWriter, r *http.Request) {
 		var participants []models.UserBasic
 		for participantRows.Next() {
 			var participant models.UserBasic
-			if err := participantRows.Scan(&participant.Username, &participant.DisplayName, &participant.ProfilePicture); err != nil {
+			var avatarVersion string
+			if err := participantRows.Scan(&participant.Username, &participant.DisplayName, &avatarVersion); err != nil {
 				participantRows.Close()
 				http.Error(w, "Failed to scan participant data", http.StatusInternalServerError)
 				return
 			}
+			participant.ProfilePicture = avatar.URL(participant.Username, avatarVersion, avatar.SizeMedium)
 			participants = append(participants, participant)
 		}
 		participantRows.Close()
@@ -119,10 +120,10 @@ func GetConversations(w http.ResponseWriter, r *http.Request) {
 // GetMessages returns all messages for a conversation
 func GetMessages(w http.ResponseWriter, r *http.Request) {
 	conversationIDStr := r.URL.Query().Get("conversation_id")
-	username := r.URL.Query().Get("username")
+	username := auth.CurrentUser(r)
 
-	if conversationIDStr == "" || username == "" {
-		http.Error(w, "Conversation ID and username are required", http.StatusBadRequest)
+	if conversationIDStr == "" {
+		http.Error(w, "Conversation ID is required", http.StatusBadRequest)
 		return
 	}
 
@@ -139,8 +140,12 @@ func GetMessages(w http.ResponseWriter, r *http.Request) {
 		FROM conversation_participants
 		WHERE conversation_id = $1 AND username = $2
 	`, conversationID, username).Scan(&count)
-	if err != nil || count == 0 {
-		http.Error(w, "User not part of conversation", http.StatusForbidden)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if count == 0 {
+		middleware.Forbidden(w)
 		return
 	}
 
@@ -204,7 +209,6 @@ func GetMessages(w http.ResponseWriter, r *http.Request) {
 func SendMessage(w http.ResponseWriter, r *http.Request) {
 	var requestData struct {
 		ConversationID int    `json:"conversation_id"`
-		Sender         string `json:"sender"`
 		Content        string `json:"content"`
 	}
 
@@ -213,20 +217,26 @@ func SendMessage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if requestData.ConversationID == 0 || requestData.Sender == "" || requestData.Content == "" {
-		http.Error(w, "Conversation ID, sender, and content are required", http.StatusBadRequest)
+	if requestData.ConversationID == 0 || requestData.Content == "" {
+		http.Error(w, "Conversation ID and content are required", http.StatusBadRequest)
 		return
 	}
 
+	sender := auth.CurrentUser(r)
+
 	// Check if user is part of the conversation
 	var count int
 	err := db.DB.QueryRow(`
 		SELECT COUNT(*)
 		FROM conversation_participants
 		WHERE conversation_id = $1 AND username = $2
-	`, requestData.ConversationID, requestData.Sender).Scan(&count)
-	if err != nil || count == 0 {
-		http.Error(w, "User not part of conversation", http.StatusForbidden)
+	`, requestData.ConversationID, sender).Scan(&count)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if count == 0 {
+		middleware.Forbidden(w)
 		return
 	}
 
@@ -236,7 +246,7 @@ func SendMessage(w http.ResponseWriter, r *http.Request) {
 		INSERT INTO messages (conversation_id, sender, content, read)
 		VALUES ($1, $2, $3, false)
 		RETURNING id
-	`, requestData.ConversationID, requestData.Sender, requestData.Content).Scan(&messageID)
+	`, requestData.ConversationID, sender, requestData.Content).Scan(&messageID)
 	if err != nil {
 		http.Error(w, "Failed to create message", http.StatusInternalServerError)
 		return
@@ -279,7 +289,6 @@ func SendMessage(w http.ResponseWriter, r *http.Request) {
 // CreateConversation creates a new conversation between two users
 func CreateConversation(w http.ResponseWriter, r *http.Request) {
 	var requestData struct {
-		Creator   string `json:"creator"`
 		Recipient string `json:"recipient"`
 		Message   string `json:"message"`
 	}
@@ -289,8 +298,14 @@ func CreateConversation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if requestData.Creator == "" || requestData.Recipient == "" || requestData.Message == "" {
-		http.Error(w, "Creator, recipient, and message are required", http.StatusBadRequest)
+	if requestData.Recipient == "" || requestData.Message == "" {
+		http.Error(w, "Recipient and message are required", http.StatusBadRequest)
+		return
+	}
+
+	creator := auth.CurrentUser(r)
+	if creator == requestData.Recipient {
+		http.Error(w, "Cannot start a conversation with yourself", http.StatusBadRequest)
 		return
 	}
 
@@ -303,7 +318,7 @@ func CreateConversation(w http.ResponseWriter, r *http.Request) {
 		JOIN conversation_participants cp2 ON c.id = cp2.conversation_id
 		WHERE cp1.username = $1 AND cp2.username = $2
 		  AND cp1.conversation_id = cp2.conversation_id
-	`, requestData.Creator, requestData.Recipient).Scan(&existingConversationID)
+	`, creator, requestData.Recipient).Scan(&existingConversationID)
 
 	var conversationID int
 
@@ -326,7 +341,7 @@ func CreateConversation(w http.ResponseWriter, r *http.Request) {
 		_, err = db.DB.Exec(`
 			INSERT INTO conversation_participants (conversation_id, username, last_read_at)
 			VALUES ($1, $2, NOW()), ($1, $3, NOW())
-		`, conversationID, requestData.Creator, requestData.Recipient)
+		`, conversationID, creator, requestData.Recipient)
 		if err != nil {
 			http.Error(w, "Failed to add participants", http.StatusInternalServerError)
 			return
@@ -339,7 +354,7 @@ func CreateConversation(w http.ResponseWriter, r *http.Request) {
 		INSERT INTO messages (conversation_id, sender, content, read)
 		VALUES ($1, $2, $3, false)
 		RETURNING id
-	`, conversationID, requestData.Creator, requestData.Message).Scan(&messageID)
+	`, conversationID, creator, requestData.Message).Scan(&messageID)
 	if err != nil {
 		http.Error(w, "Failed to create message", http.StatusInternalServerError)
 		return
@@ -359,11 +374,7 @@ func CreateConversation(w http.ResponseWriter, r *http.Request) {
 
 // GetUnreadMessagesCount returns the number of unread messages for a user
 func GetUnreadMessagesCount(w http.ResponseWriter, r *http.Request) {
-	username := r.URL.Query().Get("username")
-	if username == "" {
-		http.Error(w, "Username is required", http.StatusBadRequest)
-		return
-	}
+	username := auth.CurrentUser(r)
 
 	var count int
 	err := db.DB.QueryRow(`
@@ -392,7 +403,7 @@ func GetFollowers(w http.ResponseWriter, r *http.Request) {
 	}
 
 	rows, err := db.DB.Query(`
-		SELECT u.username, u.display_name, u.profile_picture
+		SELECT u.username, u.display_name, u.avatar_version
 		FROM follows f
 		JOIN users u ON f.follower = u.username
 		WHERE f.following = $1
@@ -406,10 +417,12 @@ func GetFollowers(w http.ResponseWriter, r *http.Request) {
 	var followers []models.UserBasic
 	for rows.Next() {
 		var follower models.UserBasic
-		if err := rows.Scan(&follower.Username, &follower.DisplayName, &follower.ProfilePicture); err != nil {
+		var avatarVersion string
+		if err := rows.Scan(&follower.Username, &follower.DisplayName, &avatarVersion); err != nil {
 			http.Error(w, "Failed to scan follower data", http.StatusInternalServerError)
 			return
 		}
+		follower.ProfilePicture = avatar.URL(follower.Username, avatarVersion, avatar.SizeMedium)
 		followers = append(followers, follower)
 	}
 
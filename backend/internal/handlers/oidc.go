@@ -0,0 +1,380 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/BenH9999/CampusConnect/backend/internal/auth"
+	"github.com/BenH9999/CampusConnect/backend/internal/config"
+	"github.com/BenH9999/CampusConnect/backend/internal/db"
+	"github.com/BenH9999/CampusConnect/backend/internal/models"
+	"github.com/BenH9999/CampusConnect/backend/internal/oidc"
+	"github.com/BenH9999/CampusConnect/backend/internal/utils"
+	"github.com/BenH9999/CampusConnect/backend/internal/validation"
+)
+
+const (
+	oidcStateTTL   = 10 * time.Minute
+	oidcHandoffTTL = 2 * time.Minute
+	// oidcBindingCookie ties a login's state to the browser that started it
+	oidcBindingCookie = "oidc_binding"
+)
+
+var errOIDCDomainNotAllowed = errors.New("email domain not allowed")
+
+// usernameUnsafeChars matches anything that can't appear in a generated username
+var usernameUnsafeChars = regexp.MustCompile(`[^a-z0-9_]+`)
+
+type OIDCExchangeInput struct {
+	Code string `json:"code"`
+}
+
+// OIDCLogin starts single sign-on by redirecting the browser to the identity provider
+func OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if oidc.Default == nil {
+		http.Error(w, oidc.ErrNotConfigured.Error(), http.StatusNotFound)
+		return
+	}
+
+	state, err1 := auth.RandomToken()
+	nonce, err2 := auth.RandomToken()
+	verifier, err3 := auth.RandomToken()
+	binding, err4 := auth.RandomToken()
+	if err := errors.Join(err1, err2, err3, err4); err != nil {
+		http.Error(w, "Failed to start login", http.StatusInternalServerError)
+		return
+	}
+
+	deviceName := sessionInfo(r, r.URL.Query().Get("device_name")).DeviceName
+
+	// Expired states are cleared here rather than by a background job
+	_, err := db.DB.Exec(`DELETE FROM oidc_states WHERE expires_at < NOW()`)
+	if err != nil {
+		log.Println("Error clearing expired SSO states:", err)
+	}
+
+	_, err = db.DB.Exec(`
+		INSERT INTO oidc_states (state, code_verifier, nonce, device_name, binding_hash, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, state, verifier, nonce, deviceName, auth.HashToken(binding), time.Now().Add(oidcStateTTL))
+	if err != nil {
+		http.Error(w, "Failed to start login", http.StatusInternalServerError)
+		return
+	}
+
+	// Without this, someone could send a victim the callback URL of a login
+	// they started themselves and sign the victim in to their account. Lax
+	// still sends the cookie on the provider's redirect back.
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcBindingCookie,
+		Value:    binding,
+		Path:     "/api/oidc/callback",
+		MaxAge:   int(oidcStateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil || strings.HasPrefix(config.GetPublicBaseURL(), "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	authURL, err := oidc.Default.AuthCodeURL(r.Context(), state, nonce, verifier)
+	if err != nil {
+		log.Println("Error building SSO authorization URL:", err)
+		http.Error(w, "Identity provider unavailable", http.StatusBadGateway)
+		return
+	}
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// OIDCCallback completes single sign-on. The user is found or created from
+// the ID token, then the browser is sent back to the app with a one-time code
+// the app exchanges for tokens, so tokens never appear in a URL.
+func OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if oidc.Default == nil {
+		http.Error(w, oidc.ErrNotConfigured.Error(), http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	if errCode := query.Get("error"); errCode != "" {
+		redirectToApp(w, r, url.Values{"error": {errCode}})
+		return
+	}
+
+	state := query.Get("state")
+	code := query.Get("code")
+	if state == "" || code == "" {
+		http.Error(w, "state and code parameters are required", http.StatusBadRequest)
+		return
+	}
+
+	binding, err := r.Cookie(oidcBindingCookie)
+	if err != nil || binding.Value == "" {
+		http.Error(w, "Login must be finished in the browser it was started in", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcBindingCookie, Path: "/api/oidc/callback", MaxAge: -1})
+
+	var verifier, nonce, deviceName string
+	err = db.DB.QueryRow(`
+		DELETE FROM oidc_states
+		WHERE state = $1 AND binding_hash = $2 AND expires_at > NOW()
+		RETURNING code_verifier, nonce, device_name
+	`, state, auth.HashToken(binding.Value)).Scan(&verifier, &nonce, &deviceName)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Login session expired, please try again", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	claims, err := oidc.Default.Exchange(r.Context(), code, verifier, nonce)
+	if err != nil {
+		log.Println("SSO code exchange failed:", err)
+		redirectToApp(w, r, url.Values{"error": {"login_failed"}})
+		return
+	}
+
+	username, err := findOrCreateOIDCUser(claims)
+	if err != nil {
+		if errors.Is(err, errOIDCDomainNotAllowed) {
+			redirectToApp(w, r, url.Values{"error": {"domain_not_allowed"}})
+			return
+		}
+		log.Println("Error linking SSO account:", err)
+		redirectToApp(w, r, url.Values{"error": {"login_failed"}})
+		return
+	}
+
+	handoff, err := auth.RandomToken()
+	if err != nil {
+		http.Error(w, "Failed to complete login", http.StatusInternalServerError)
+		return
+	}
+	_, err = db.DB.Exec(`
+		INSERT INTO oidc_handoffs (code_hash, username, device_name, expires_at)
+		VALUES ($1, $2, $3, $4)
+	`, auth.HashToken(handoff), username, deviceName, time.Now().Add(oidcHandoffTTL))
+	if err != nil {
+		http.Error(w, "Failed to complete login", http.StatusInternalServerError)
+		return
+	}
+
+	redirectToApp(w, r, url.Values{"code": {handoff}})
+}
+
+// OIDCExchange swaps the one-time code from OIDCCallback for a session
+func OIDCExchange(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input OIDCExchangeInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Code == "" {
+		http.Error(w, "code is required", http.StatusBadRequest)
+		return
+	}
+
+	var username, deviceName string
+	err := db.DB.QueryRow(`
+		DELETE FROM oidc_handoffs
+		WHERE code_hash = $1 AND expires_at > NOW()
+		RETURNING username, device_name
+	`, auth.HashToken(input.Code)).Scan(&username, &deviceName)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Invalid or expired code", http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	var user models.User
+	err = db.DB.QueryRow(`
+		SELECT username, email, display_name, avatar_version, affiliation, totp_enabled_at, deletion_scheduled_for FROM users WHERE username = $1
+	`, username).Scan(&user.Username, &user.Email, &user.DisplayName, &user.AvatarVersion, &user.Affiliation, &user.TOTPEnabledAt, &user.DeletionScheduledFor)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	// SSO stands in for the password only; 2FA is still required
+	if user.TOTPEnabledAt != nil {
+		writeTwoFactorChallenge(w, user.Username, deviceName)
+		return
+	}
+
+	completeLogin(w, r, user, deviceName)
+}
+
+// findOrCreateOIDCUser returns the user linked to the SSO subject. On first
+// SSO login a user with the same verified email is linked, an unverified one
+// is reset and claimed, and otherwise a new account is created.
+func findOrCreateOIDCUser(claims *oidc.Claims) (string, error) {
+	var username string
+	err := db.DB.QueryRow(`SELECT username FROM users WHERE oidc_subject = $1`, claims.Subject).Scan(&username)
+	if err == nil {
+		return username, nil
+	}
+	if err != sql.ErrNoRows {
+		return "", err
+	}
+
+	// Only trust the email for linking if the provider vouches for it
+	if claims.Email == "" || !claims.EmailVerified {
+		return "", errors.New("identity provider did not return a verified email")
+	}
+
+	err = db.DB.QueryRow(`
+		UPDATE users SET oidc_subject = $1
+		WHERE LOWER(email) = LOWER($2) AND oidc_subject IS NULL AND email_verified_at IS NOT NULL
+		RETURNING username
+	`, claims.Subject, claims.Email).Scan(&username)
+	if err == nil {
+		return username, nil
+	}
+	if err != sql.ErrNoRows {
+		return "", err
+	}
+
+	username, err = claimUnverifiedUser(claims)
+	if err == nil {
+		return username, nil
+	}
+	if err != sql.ErrNoRows {
+		return "", err
+	}
+
+	affiliation, allowed, err := utils.ResolveAffiliation(claims.Email)
+	if err != nil {
+		return "", err
+	}
+	if !allowed {
+		return "", errOIDCDomainNotAllowed
+	}
+
+	username, err = availableUsername(oidcUsernameBase(claims))
+	if err != nil {
+		return "", err
+	}
+
+	// SSO accounts get a random password nobody knows; a password can be set
+	// later through the reset flow
+	secret, err := auth.RandomToken()
+	if err != nil {
+		return "", err
+	}
+	hash, err := auth.HashPassword(secret)
+	if err != nil {
+		return "", err
+	}
+
+	displayName := claims.Name
+	if displayName == "" {
+		displayName = username
+	}
+	if runes := []rune(displayName); len(runes) > 50 {
+		displayName = string(runes[:50])
+	}
+
+	_, err = db.DB.Exec(`
+		INSERT INTO users (username, email, password, display_name, affiliation, oidc_subject, email_verified_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW())
+	`, username, claims.Email, hash, displayName, affiliation, claims.Subject)
+	if err != nil {
+		return "", err
+	}
+
+	return username, nil
+}
+
+// claimUnverifiedUser links the SSO subject to an account registered with
+// the same email that was never verified. Whoever registered it hasn't shown
+// they own the address, so its password, 2FA and sessions are reset in the
+// same transaction rather than handed over along with the account. Returns
+// sql.ErrNoRows if there is no such account.
+func claimUnverifiedUser(claims *oidc.Claims) (string, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var username string
+	err = tx.QueryRow(`
+		SELECT username FROM users
+		WHERE LOWER(email) = LOWER($1) AND oidc_subject IS NULL AND email_verified_at IS NULL
+		FOR UPDATE
+	`, claims.Email).Scan(&username)
+	if err != nil {
+		return "", err
+	}
+
+	if err := auth.ResetCredentials(tx, username); err != nil {
+		return "", err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE users SET oidc_subject = $1, email_verified_at = NOW()
+		WHERE username = $2
+	`, claims.Subject, username)
+	if err != nil {
+		return "", err
+	}
+
+	return username, tx.Commit()
+}
+
+// oidcUsernameBase picks a username from the claims, preferring the
+// provider's username over the email's local part
+func oidcUsernameBase(claims *oidc.Claims) string {
+	base := claims.PreferredUsername
+	if base == "" || strings.Contains(base, "@") {
+		base, _, _ = strings.Cut(claims.Email, "@")
+	}
+	base = usernameUnsafeChars.ReplaceAllString(strings.ToLower(base), "")
+
+	// Leave room for a numeric suffix within the username length limit
+	if len(base) > validation.UsernameMaxLength-3 {
+		base = base[:validation.UsernameMaxLength-3]
+	}
+	if len(base) < validation.UsernameMinLength {
+		base = "user" + base
+	}
+	return base
+}
+
+// availableUsername returns base, or base with a number appended if it's taken
+func availableUsername(base string) (string, error) {
+	candidate := base
+	for i := 2; i < 1000; i++ {
+		var taken bool
+		err := db.DB.QueryRow(`
+			SELECT EXISTS(SELECT 1 FROM users WHERE LOWER(username) = LOWER($1))
+				OR EXISTS(SELECT 1 FROM username_history WHERE LOWER(old_username) = LOWER($1) AND reclaimable_at > NOW())
+		`, candidate).Scan(&taken)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s%d", base, i)
+	}
+	return "", errors.New("no username available for " + base)
+}
+
+func redirectToApp(w http.ResponseWriter, r *http.Request, params url.Values) {
+	http.Redirect(w, r, config.GetOIDCConfig().AppRedirectURL+"?"+params.Encode(), http.StatusFound)
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 50
+)
+
+// pageParams reads keyset pagination parameters: ?before= is the last id the
+// client has seen (0 for the first page) and ?limit= the page size. ok is
+// false if either is malformed.
+func pageParams(r *http.Request) (before, limit int, ok bool) {
+	query := r.URL.Query()
+	limit = defaultPageSize
+	if s := query.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return 0, 0, false
+		}
+		limit = min(n, maxPageSize)
+	}
+	if s := query.Get("before"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return 0, 0, false
+		}
+		before = n
+	}
+	return before, limit, true
+}
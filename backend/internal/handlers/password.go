@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/BenH9999/CampusConnect/backend/internal/auth"
+	"github.com/BenH9999/CampusConnect/backend/internal/config"
+	"github.com/BenH9999/CampusConnect/backend/internal/db"
+	"github.com/BenH9999/CampusConnect/backend/internal/mailer"
+	"github.com/BenH9999/CampusConnect/backend/internal/validation"
+)
+
+type ForgotPasswordInput struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordInput struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+type ChangePasswordInput struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// ForgotPassword emails a password reset link if the address belongs to an account
+func ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input ForgotPasswordInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Email == "" {
+		http.Error(w, "email is required", http.StatusBadRequest)
+		return
+	}
+
+	// Same response whether or not the address is registered
+	response := map[string]string{"message": "If that account exists, a password reset email has been sent"}
+
+	var username, email string
+	var lastSentAt sql.NullTime
+	err := db.DB.QueryRow(`
+		SELECT u.username, u.email, (SELECT MAX(created_at) FROM password_resets pr WHERE pr.username = u.username)
+		FROM users u WHERE LOWER(u.email) = LOWER($1)
+	`, input.Email).Scan(&username, &email, &lastSentAt)
+	if err != nil && err != sql.ErrNoRows {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	// Requests during the cooldown are quietly dropped so nobody can flood an
+	// inbox, and failures are only logged; either way the response is the
+	// same as for an unknown address
+	coolingDown := lastSentAt.Valid && time.Now().Before(lastSentAt.Time.Add(config.GetPasswordResetCooldown()))
+	if err == nil && !coolingDown {
+		sendPasswordResetEmail(username, email)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// sendPasswordResetEmail creates a reset token and emails the link to the user
+func sendPasswordResetEmail(username, email string) {
+	token, err := auth.CreatePasswordReset(username)
+	if err != nil {
+		log.Println("Error creating password reset token:", err)
+		return
+	}
+
+	link := config.GetPasswordResetURL() + "?token=" + url.QueryEscape(token)
+	err = mailer.Send(mailer.Message{
+		To:      email,
+		Subject: "Reset your CampusConnect password",
+		Body: "Hi " + username + ",\n\n" +
+			"Someone asked to reset the password for your account. Open the link below to choose a new one:\n\n" +
+			link + "\n\n" +
+			"The link can be used once and expires in " + strconv.Itoa(int(config.GetPasswordResetTTL().Minutes())) + " minutes. " +
+			"If you didn't ask for this you can ignore this email.\n",
+	})
+	if err != nil {
+		log.Println("Error sending password reset email:", err)
+	}
+}
+
+// ResetPassword sets a new password using a token from a reset email
+func ResetPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input ResetPasswordInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Token == "" {
+		http.Error(w, "token and new_password are required", http.StatusBadRequest)
+		return
+	}
+
+	var errs validation.Errors
+	errs.Password("new_password", input.NewPassword, "")
+	if errs.Any() {
+		writeValidationErrors(w, errs)
+		return
+	}
+
+	_, err := auth.ResetPassword(input.Token, input.NewPassword)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidResetToken) {
+			http.Error(w, "Invalid or expired reset token", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Failed to reset password", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Password updated, please log in again"})
+}
+
+// ChangePassword updates the caller's password and signs out their other sessions
+func ChangePassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input ChangePasswordInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.CurrentPassword == "" {
+		http.Error(w, "current_password and new_password are required", http.StatusBadRequest)
+		return
+	}
+
+	var errs validation.Errors
+	errs.Password("new_password", input.NewPassword, auth.CurrentUser(r))
+	if errs.Any() {
+		writeValidationErrors(w, errs)
+		return
+	}
+
+	err := auth.ChangePassword(auth.CurrentUser(r), input.CurrentPassword, input.NewPassword, auth.CurrentSession(r))
+	if err != nil {
+		if errors.Is(err, auth.ErrWrongPassword) {
+			http.Error(w, "Current password is incorrect", http.StatusForbidden)
+			return
+		}
+		http.Error(w, "Failed to change password", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
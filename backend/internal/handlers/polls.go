@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/BenH9999/CampusConnect/backend/internal/auth"
+	"github.com/BenH9999/CampusConnect/backend/internal/polls"
+)
+
+type VotePollInput struct {
+	PostID    int   `json:"post_id"`
+	OptionIDs []int `json:"option_ids"`
+}
+
+type RetractVoteInput struct {
+	PostID int `json:"post_id"`
+}
+
+// VotePoll casts the caller's vote in a post's poll and returns the updated
+// poll
+func VotePoll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input VotePollInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.PostID == 0 {
+		http.Error(w, "post_id and option_ids are required", http.StatusBadRequest)
+		return
+	}
+
+	if !requireVisiblePost(w, r, input.PostID) {
+		return
+	}
+
+	username := auth.CurrentUser(r)
+	if err := polls.Vote(input.PostID, username, input.OptionIDs); err != nil {
+		writePollError(w, err)
+		return
+	}
+
+	writePoll(w, input.PostID, username)
+}
+
+// RetractVote removes the caller's vote from a post's poll so they can vote
+// again
+func RetractVote(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input RetractVoteInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.PostID == 0 {
+		http.Error(w, "post_id is required", http.StatusBadRequest)
+		return
+	}
+
+	if !requireVisiblePost(w, r, input.PostID) {
+		return
+	}
+
+	username := auth.CurrentUser(r)
+	if err := polls.Retract(input.PostID, username); err != nil {
+		writePollError(w, err)
+		return
+	}
+
+	writePoll(w, input.PostID, username)
+}
+
+func writePollError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, polls.ErrNotFound):
+		http.Error(w, "Poll not found", http.StatusNotFound)
+	case errors.Is(err, polls.ErrClosed):
+		http.Error(w, "Poll is closed", http.StatusConflict)
+	case errors.Is(err, polls.ErrAlreadyVoted):
+		http.Error(w, "You have already voted in this poll", http.StatusConflict)
+	case errors.Is(err, polls.ErrNotVoted):
+		http.Error(w, "You haven't voted in this poll", http.StatusConflict)
+	case errors.Is(err, polls.ErrInvalidChoice):
+		http.Error(w, "Choose one of the poll's options, or several if it allows multiple choices", http.StatusBadRequest)
+	default:
+		http.Error(w, "Failed to record vote", http.StatusInternalServerError)
+	}
+}
+
+func writePoll(w http.ResponseWriter, postID int, viewer string) {
+	postPolls, err := polls.ForPosts([]int{postID}, viewer)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(postPolls[postID])
+}
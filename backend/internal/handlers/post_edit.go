@@ -0,0 +1,376 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BenH9999/CampusConnect/backend/internal/auth"
+	"github.com/BenH9999/CampusConnect/backend/internal/db"
+	"github.com/BenH9999/CampusConnect/backend/internal/hashtags"
+	"github.com/BenH9999/CampusConnect/backend/internal/linkpreview"
+	"github.com/BenH9999/CampusConnect/backend/internal/media"
+	"github.com/BenH9999/CampusConnect/backend/internal/mentions"
+	"github.com/BenH9999/CampusConnect/backend/internal/middleware"
+	"github.com/BenH9999/CampusConnect/backend/internal/models"
+	"github.com/BenH9999/CampusConnect/backend/internal/polls"
+	"github.com/BenH9999/CampusConnect/backend/internal/utils"
+)
+
+type EditPostInput struct {
+	ID      int    `json:"id"`
+	Content string `json:"content"`
+	// Visibility is left unchanged if empty
+	Visibility models.Visibility `json:"visibility"`
+}
+
+type DeletePostInput struct {
+	ID int `json:"id"`
+}
+
+type PinPostInput struct {
+	ID int `json:"id"`
+}
+
+// EditPost replaces the content of one of the caller's posts, keeping the
+// previous version in post_revisions
+func EditPost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input EditPostInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.ID == 0 {
+		http.Error(w, "id and content are required", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(input.Content) == "" {
+		http.Error(w, "Content is required", http.StatusBadRequest)
+		return
+	}
+	if input.Visibility != "" && !input.Visibility.Valid() {
+		http.Error(w, "visibility must be public, campus, followers or private", http.StatusBadRequest)
+		return
+	}
+	if !requireVisiblePost(w, r, input.ID) {
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var post PostResponse
+	var mentioned, links []string
+	err = tx.QueryRow(`
+		SELECT username, content, created_at, edited_at, quoted_post_id, visibility, published, publish_at
+		FROM posts WHERE id = $1
+		FOR UPDATE
+	`, input.ID).Scan(&post.Username, &post.Content, &post.CreatedAt, &post.EditedAt, &post.QuotedPostID, &post.Visibility, &post.Published, &post.PublishAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Post not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	if post.Username != auth.CurrentUser(r) {
+		middleware.Forbidden(w)
+		return
+	}
+
+	// Saving without changes shouldn't mark the post as edited
+	contentChanged := post.Content != input.Content
+	switch {
+	case contentChanged && !post.Published:
+		// Nobody else has seen a draft, so rewriting one isn't an edit and
+		// keeps no history
+		_, err = tx.Exec(`UPDATE posts SET content = $1 WHERE id = $2`, input.Content, input.ID)
+		if err != nil {
+			http.Error(w, "Failed to update post", http.StatusInternalServerError)
+			return
+		}
+
+	case contentChanged:
+		versionCreatedAt := post.CreatedAt
+		if post.EditedAt != nil {
+			versionCreatedAt = *post.EditedAt
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO post_revisions (post_id, content, created_at) VALUES ($1, $2, $3)
+		`, input.ID, post.Content, versionCreatedAt)
+		if err != nil {
+			http.Error(w, "Failed to save post history", http.StatusInternalServerError)
+			return
+		}
+
+		var editedAt time.Time
+		err = tx.QueryRow(`
+			UPDATE posts SET content = $1, edited_at = NOW() WHERE id = $2 RETURNING edited_at
+		`, input.Content, input.ID).Scan(&editedAt)
+		if err != nil {
+			http.Error(w, "Failed to update post", http.StatusInternalServerError)
+			return
+		}
+		post.EditedAt = &editedAt
+	}
+
+	if contentChanged {
+		post.Content = input.Content
+
+		if err := hashtags.Save(tx, input.ID, input.Content); err != nil {
+			http.Error(w, "Failed to save hashtags", http.StatusInternalServerError)
+			return
+		}
+		links, err = linkpreview.Save(tx, input.ID, input.Content)
+		if err != nil {
+			http.Error(w, "Failed to save links", http.StatusInternalServerError)
+			return
+		}
+
+		// Only people newly mentioned by the edit are notified, and not
+		// until a draft is published
+		mentioned, err = mentions.Save(tx, &input.ID, nil, input.Content)
+		if err != nil {
+			http.Error(w, "Failed to save mentions", http.StatusInternalServerError)
+			return
+		}
+		if !post.Published {
+			mentioned = nil
+		}
+	}
+
+	// Changing who can see a post isn't an edit of its content, so it
+	// doesn't add a revision
+	if input.Visibility != "" && input.Visibility != post.Visibility {
+		_, err = tx.Exec(`UPDATE posts SET visibility = $1 WHERE id = $2`, input.Visibility, input.ID)
+		if err != nil {
+			http.Error(w, "Failed to update post", http.StatusInternalServerError)
+			return
+		}
+		post.Visibility = input.Visibility
+	}
+
+	err = tx.QueryRow(`
+		SELECT
+			(SELECT COUNT(*) FROM likes WHERE post_id = $1),
+			(SELECT COUNT(*) FROM comments WHERE post_id = $1),
+			(SELECT COUNT(*) FROM reposts WHERE post_id = $1)
+	`, input.ID).Scan(&post.LikesCount, &post.CommentsCount, &post.RepostsCount)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to update post", http.StatusInternalServerError)
+		return
+	}
+
+	for _, m := range mentioned {
+		utils.CreateMentionNotification(m, post.Username, input.ID, nil)
+	}
+	if len(links) > 0 {
+		go linkpreview.Refresh(links)
+	}
+
+	post.ID = input.ID
+	attachments, err := media.ForPosts([]int{post.ID})
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	post.Attachments = withoutNil(attachments[post.ID])
+
+	postMentions, err := mentions.ForPosts([]int{post.ID})
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	post.Mentions = withoutNil(postMentions[post.ID])
+
+	postPolls, err := polls.ForPosts([]int{post.ID}, post.Username)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	post.Poll = postPolls[post.ID]
+
+	bookmarked, err := bookmarkedPosts([]int{post.ID}, post.Username)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	post.IsBookmarked = bookmarked[post.ID]
+
+	if post.QuotedPostID != nil {
+		quoted, err := quotedPosts([]int{*post.QuotedPostID}, post.Username)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		post.QuotedPost = quoted[*post.QuotedPostID]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(post)
+}
+
+// DeletePost removes a post. Authors can delete their own posts and
+// moderators can delete anyone's. Likes, comments, revisions and the
+// notifications about them all go with it through the foreign keys;
+// attachments are left for the cleanup job to remove from storage.
+func DeletePost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input DeletePostInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.ID == 0 {
+		http.Error(w, "id is required", http.StatusBadRequest)
+		return
+	}
+	// Moderators can delete any post, so only others need hidden posts to
+	// look missing
+	moderator := auth.Can(r, auth.PermModerateContent)
+	if !moderator && !requireVisiblePost(w, r, input.ID) {
+		return
+	}
+
+	var author string
+	err := db.DB.QueryRow(`SELECT username FROM posts WHERE id = $1`, input.ID).Scan(&author)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Post not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	if author != auth.CurrentUser(r) && !moderator {
+		middleware.Forbidden(w)
+		return
+	}
+
+	if _, err := db.DB.Exec(`DELETE FROM posts WHERE id = $1`, input.ID); err != nil {
+		http.Error(w, "Failed to delete post", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
+
+// PinPost pins one of the caller's posts to the top of their profile,
+// replacing any post pinned before
+func PinPost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input PinPostInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.ID == 0 {
+		http.Error(w, "id is required", http.StatusBadRequest)
+		return
+	}
+	if !requireVisiblePost(w, r, input.ID) {
+		return
+	}
+
+	username := auth.CurrentUser(r)
+	var author string
+	var published bool
+	err := db.DB.QueryRow(`SELECT username, published FROM posts WHERE id = $1`, input.ID).Scan(&author, &published)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Post not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	if author != username {
+		middleware.Forbidden(w)
+		return
+	}
+	if !published {
+		http.Error(w, "Drafts and scheduled posts can't be pinned", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := db.DB.Exec(`UPDATE users SET pinned_post_id = $1 WHERE username = $2`, input.ID, username); err != nil {
+		http.Error(w, "Failed to pin post", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"success": true, "pinned_post_id": input.ID})
+}
+
+// UnpinPost clears the post pinned to the caller's profile
+func UnpinPost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if _, err := db.DB.Exec(`UPDATE users SET pinned_post_id = NULL WHERE username = $1`, auth.CurrentUser(r)); err != nil {
+		http.Error(w, "Failed to unpin post", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
+
+// GetPostHistory lists the earlier versions of a post, oldest first
+func GetPostHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Post id parameter required", http.StatusBadRequest)
+		return
+	}
+
+	if !requireVisiblePost(w, r, id) {
+		return
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT id, post_id, content, created_at, replaced_at
+		FROM post_revisions
+		WHERE post_id = $1
+		ORDER BY replaced_at ASC
+	`, id)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	revisions := []models.PostRevision{}
+	for rows.Next() {
+		var rev models.PostRevision
+		if err := rows.Scan(&rev.ID, &rev.PostID, &rev.Content, &rev.CreatedAt, &rev.ReplacedAt); err != nil {
+			http.Error(w, "Error scanning revision", http.StatusInternalServerError)
+			return
+		}
+		revisions = append(revisions, rev)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revisions)
+}
@@ -2,26 +2,58 @@ package handlers
 
 import (
 	"database/sql"
-	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/BenH9999/CampusConnect/backend/internal/auth"
+	"github.com/BenH9999/CampusConnect/backend/internal/avatar"
 	"github.com/BenH9999/CampusConnect/backend/internal/db"
+	"github.com/BenH9999/CampusConnect/backend/internal/hashtags"
+	"github.com/BenH9999/CampusConnect/backend/internal/linkpreview"
+	"github.com/BenH9999/CampusConnect/backend/internal/media"
+	"github.com/BenH9999/CampusConnect/backend/internal/mentions"
+	"github.com/BenH9999/CampusConnect/backend/internal/models"
+	"github.com/BenH9999/CampusConnect/backend/internal/polls"
+	"github.com/BenH9999/CampusConnect/backend/internal/utils"
+	"github.com/BenH9999/CampusConnect/backend/internal/visibility"
 )
 
 type CreatePostInput struct {
-	Username string `json:"username"`
-	Content  string `json:"content"`
+	Content       string `json:"content"`
+	AttachmentIDs []int  `json:"attachment_ids"`
+	QuotedPostID  *int   `json:"quoted_post_id"`
+	// Visibility defaults to public
+	Visibility models.Visibility `json:"visibility"`
+	// Draft saves the post without publishing it. Setting PublishAt instead
+	// schedules it to be published at that time.
+	Draft     bool         `json:"draft"`
+	PublishAt *time.Time   `json:"publish_at"`
+	Poll      *polls.Input `json:"poll"`
 }
 
 type PostResponse struct {
-	ID            int       `json:"id"`
-	Username      string    `json:"username"`
-	Content       string    `json:"content"`
-	CreatedAt     time.Time `json:"created_at"`
-	LikesCount    int       `json:"likes_count"`
-	CommentsCount int       `json:"comments_count"`
+	ID            int        `json:"id"`
+	Username      string     `json:"username"`
+	Content       string     `json:"content"`
+	CreatedAt     time.Time  `json:"created_at"`
+	EditedAt      *time.Time `json:"edited_at"`
+	LikesCount    int        `json:"likes_count"`
+	CommentsCount int        `json:"comments_count"`
+	RepostsCount  int        `json:"reposts_count"`
+	QuotedPostID  *int       `json:"quoted_post_id"`
+
+	Visibility   models.Visibility `json:"visibility"`
+	Published    bool              `json:"published"`
+	PublishAt    *time.Time        `json:"publish_at"`
+	IsBookmarked bool              `json:"is_bookmarked"`
+
+	Attachments []models.Attachment `json:"attachments"`
+	Mentions    []models.Mention    `json:"mentions"`
+	QuotedPost  *QuotedPost         `json:"quoted_post"`
+	Poll        *models.Poll        `json:"poll"`
 }
 
 func CreatePost(w http.ResponseWriter, r *http.Request) {
@@ -32,15 +64,127 @@ func CreatePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if input.Username == "" || input.Content == "" {
-		http.Error(w, "Username and Content are required", http.StatusBadRequest)
+	// A post can be just attachments, such as a photo with no caption
+	if input.Content == "" && len(input.AttachmentIDs) == 0 {
+		http.Error(w, "Content is required", http.StatusBadRequest)
+		return
+	}
+	if len(input.AttachmentIDs) > media.MaxAttachmentsPerPost {
+		http.Error(w, "A post can have at most "+strconv.Itoa(media.MaxAttachmentsPerPost)+" attachments", http.StatusBadRequest)
+		return
+	}
+	if input.Visibility == "" {
+		input.Visibility = models.VisibilityPublic
+	}
+	if !input.Visibility.Valid() {
+		http.Error(w, "visibility must be public, campus, followers or private", http.StatusBadRequest)
+		return
+	}
+	if input.PublishAt != nil && !input.PublishAt.After(time.Now()) {
+		http.Error(w, "publish_at must be in the future", http.StatusBadRequest)
 		return
 	}
+	published := !input.Draft && input.PublishAt == nil
+	if input.Poll != nil {
+		publishAt := time.Now()
+		if input.PublishAt != nil {
+			publishAt = *input.PublishAt
+		}
+		if err := input.Poll.Validate(publishAt); err != nil {
+			http.Error(w, pollInputError(err), http.StatusBadRequest)
+			return
+		}
+	}
 
-	query := `INSERT INTO posts (username, content, created_at) VALUES ($1, $2, NOW()) RETURNING id, created_at`
+	username := auth.CurrentUser(r)
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	if input.QuotedPostID != nil {
+		visible, err := visibility.CanView(username, *input.QuotedPostID)
+		if err != nil {
+			http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !visible {
+			http.Error(w, "Quoted post not found", http.StatusBadRequest)
+			return
+		}
+	}
+
+	query := `INSERT INTO posts (username, content, quoted_post_id, visibility, published, publish_at, created_at) VALUES ($1, $2, $3, $4, $5, $6, NOW()) RETURNING id, created_at`
 	var id int
 	var createdAt time.Time
-	err = db.DB.QueryRow(query, input.Username, input.Content).Scan(&id, &createdAt)
+	err = tx.QueryRow(query, username, input.Content, input.QuotedPostID, input.Visibility, published, input.PublishAt).Scan(&id, &createdAt)
+	if err != nil {
+		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := media.Attach(tx, id, username, input.AttachmentIDs); err != nil {
+		if errors.Is(err, media.ErrInvalidAttachment) {
+			http.Error(w, "Attachment not found or already used on another post", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Failed to attach files", http.StatusInternalServerError)
+		return
+	}
+
+	if input.Poll != nil {
+		if err := polls.Create(tx, id, *input.Poll); err != nil {
+			http.Error(w, "Failed to save poll", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := hashtags.Save(tx, id, input.Content); err != nil {
+		http.Error(w, "Failed to save hashtags", http.StatusInternalServerError)
+		return
+	}
+
+	mentioned, err := mentions.Save(tx, &id, nil, input.Content)
+	if err != nil {
+		http.Error(w, "Failed to save mentions", http.StatusInternalServerError)
+		return
+	}
+
+	links, err := linkpreview.Save(tx, id, input.Content)
+	if err != nil {
+		http.Error(w, "Failed to save links", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Previews are fetched in the background and show up once they're ready
+	if len(links) > 0 {
+		go linkpreview.Refresh(links)
+	}
+
+	// Drafts and scheduled posts notify people when they're published
+	if published {
+		for _, m := range mentioned {
+			utils.CreateMentionNotification(m, username, id, nil)
+		}
+		if input.QuotedPostID != nil {
+			utils.CreateQuoteNotification(*input.QuotedPostID, id, username)
+		}
+	}
+
+	attachments, err := media.ForPosts([]int{id})
+	if err != nil {
+		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	postMentions, err := mentions.ForPosts([]int{id})
 	if err != nil {
 		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -48,26 +192,78 @@ func CreatePost(w http.ResponseWriter, r *http.Request) {
 
 	post := PostResponse{
 		ID:            id,
-		Username:      input.Username,
+		Username:      username,
 		Content:       input.Content,
 		CreatedAt:     createdAt,
 		LikesCount:    0,
 		CommentsCount: 0,
+		QuotedPostID:  input.QuotedPostID,
+		Visibility:    input.Visibility,
+		Published:     published,
+		PublishAt:     input.PublishAt,
+		Attachments:   withoutNil(attachments[id]),
+		Mentions:      withoutNil(postMentions[id]),
+	}
+	if post.QuotedPostID != nil {
+		quoted, err := quotedPosts([]int{*post.QuotedPostID}, username)
+		if err != nil {
+			http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		post.QuotedPost = quoted[*post.QuotedPostID]
+	}
+	if input.Poll != nil {
+		postPolls, err := polls.ForPosts([]int{id}, username)
+		if err != nil {
+			http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		post.Poll = postPolls[id]
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(post)
 }
 
+// pollInputError describes what's wrong with a poll sent with a new post
+func pollInputError(err error) string {
+	switch {
+	case errors.Is(err, polls.ErrOptionCount):
+		return "A poll needs between " + strconv.Itoa(polls.MinOptions) + " and " + strconv.Itoa(polls.MaxOptions) + " options"
+	case errors.Is(err, polls.ErrOptionText):
+		return "Poll options must be between 1 and " + strconv.Itoa(polls.MaxOptionLength) + " characters"
+	case errors.Is(err, polls.ErrDuplicateOption):
+		return "Poll options must all be different"
+	case errors.Is(err, polls.ErrClosesTooSoon):
+		return "closes_at must be after the post is published"
+	}
+	return "Invalid poll"
+}
+
 type PostDetail struct {
-	ID             int       `json:"id"`
-	Username       string    `json:"username"`
-	DisplayName    string    `json:"display_name"`
-	ProfilePicture string    `json:"profile_picture"`
-	Content        string    `json:"content"`
-	CreatedAt      time.Time `json:"created_at"`
-	LikesCount     int       `json:"likes_count"`
-	CommentsCount  int       `json:"comments_count"`
+	ID             int        `json:"id"`
+	Username       string     `json:"username"`
+	DisplayName    string     `json:"display_name"`
+	ProfilePicture string     `json:"profile_picture"`
+	Content        string     `json:"content"`
+	CreatedAt      time.Time  `json:"created_at"`
+	EditedAt       *time.Time `json:"edited_at"`
+	LikesCount     int        `json:"likes_count"`
+	CommentsCount  int        `json:"comments_count"`
+	RepostsCount   int        `json:"reposts_count"`
+	QuotedPostID   *int       `json:"quoted_post_id"`
+
+	Visibility   models.Visibility `json:"visibility"`
+	Published    bool              `json:"published"`
+	PublishAt    *time.Time        `json:"publish_at"`
+	IsBookmarked bool              `json:"is_bookmarked"`
+
+	Attachments []models.Attachment `json:"attachments"`
+	Mentions    []models.Mention    `json:"mentions"`
+	QuotedPost  *QuotedPost         `json:"quoted_post"`
+	Poll        *models.Poll        `json:"poll"`
+
+	LinkPreviews []models.LinkPreview `json:"link_previews"`
 }
 
 type CommentDetail struct {
@@ -78,6 +274,8 @@ type CommentDetail struct {
 	ProfilePicture string    `json:"profile_picture"`
 	Content        string    `json:"content"`
 	CreatedAt      time.Time `json:"created_at"`
+
+	Mentions []models.Mention `json:"mentions"`
 }
 
 type ViewPostResponse struct {
@@ -97,27 +295,39 @@ func ViewPost(w http.ResponseWriter, r *http.Request) {
 		p.id,
 		p.content,
 		p.created_at,
+		p.edited_at,
 		(SELECT COUNT(*) FROM likes l WHERE l.post_id = p.id) AS likes_count,
 		(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id) AS comments_count,
+		(SELECT COUNT(*) FROM reposts rp WHERE rp.post_id = p.id) AS reposts_count,
+		p.quoted_post_id,
+		p.visibility,
+		p.published,
+		p.publish_at,
 		u.username,
 		u.display_name,
-		u.profile_picture
+		u.avatar_version
 	FROM posts p
 	JOIN users u ON p.username = u.username
-	WHERE p.id = $1
-	`
+	WHERE p.id = $1 AND ` + visibility.Clause("p", "$2")
 
 	var post PostDetail
-	var rawPic []byte
-	err := db.DB.QueryRow(postQuery, idStr).Scan(
+	var avatarVersion string
+	viewer := auth.CurrentUser(r)
+	err := db.DB.QueryRow(postQuery, idStr, viewer).Scan(
 		&post.ID,
 		&post.Content,
 		&post.CreatedAt,
+		&post.EditedAt,
 		&post.LikesCount,
 		&post.CommentsCount,
+		&post.RepostsCount,
+		&post.QuotedPostID,
+		&post.Visibility,
+		&post.Published,
+		&post.PublishAt,
 		&post.Username,
 		&post.DisplayName,
-		&rawPic,
+		&avatarVersion,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -128,11 +338,51 @@ func ViewPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if len(rawPic) > 0 {
-		post.ProfilePicture = "data:image/png;base64," + base64.StdEncoding.EncodeToString(rawPic)
-	} else {
-		post.ProfilePicture = ""
+	post.ProfilePicture = avatar.URL(post.Username, avatarVersion, avatar.SizeMedium)
+
+	attachments, err := media.ForPosts([]int{post.ID})
+	if err != nil {
+		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	post.Attachments = withoutNil(attachments[post.ID])
+
+	postMentions, err := mentions.ForPosts([]int{post.ID})
+	if err != nil {
+		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	post.Mentions = withoutNil(postMentions[post.ID])
+
+	if post.QuotedPostID != nil {
+		quoted, err := quotedPosts([]int{*post.QuotedPostID}, viewer)
+		if err != nil {
+			http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		post.QuotedPost = quoted[*post.QuotedPostID]
+	}
+
+	postPolls, err := polls.ForPosts([]int{post.ID}, viewer)
+	if err != nil {
+		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	post.Poll = postPolls[post.ID]
+
+	previews, err := linkpreview.ForPosts([]int{post.ID})
+	if err != nil {
+		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	post.LinkPreviews = withoutNil(previews[post.ID])
+
+	bookmarked, err := bookmarkedPosts([]int{post.ID}, viewer)
+	if err != nil {
+		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
 	}
+	post.IsBookmarked = bookmarked[post.ID]
 
 	commentQuery := `
 	SELECT 
@@ -142,7 +392,7 @@ func ViewPost(w http.ResponseWriter, r *http.Request) {
 		c.created_at,
 		u.username,
 		u.display_name,
-		u.profile_picture
+		u.avatar_version
 	FROM comments c
 	JOIN users u ON c.username = u.username
 	WHERE c.post_id = $1
@@ -158,7 +408,7 @@ func ViewPost(w http.ResponseWriter, r *http.Request) {
 	var comments []CommentDetail
 	for rows.Next() {
 		var comment CommentDetail
-		var cRawPic []byte
+		var cAvatarVersion string
 		err := rows.Scan(
 			&comment.ID,
 			&comment.PostID,
@@ -166,20 +416,29 @@ func ViewPost(w http.ResponseWriter, r *http.Request) {
 			&comment.CreatedAt,
 			&comment.Username,
 			&comment.DisplayName,
-			&cRawPic,
+			&cAvatarVersion,
 		)
 		if err != nil {
 			http.Error(w, "Error scanning comment: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
-		if len(cRawPic) > 0 {
-			comment.ProfilePicture = "data:image/png;base64," + base64.StdEncoding.EncodeToString(cRawPic)
-		} else {
-			comment.ProfilePicture = ""
-		}
+		comment.ProfilePicture = avatar.URL(comment.Username, cAvatarVersion, avatar.SizeMedium)
 		comments = append(comments, comment)
 	}
 
+	commentIDs := make([]int, len(comments))
+	for i := range comments {
+		commentIDs[i] = comments[i].ID
+	}
+	commentMentions, err := mentions.ForComments(commentIDs)
+	if err != nil {
+		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for i := range comments {
+		comments[i].Mentions = withoutNil(commentMentions[comments[i].ID])
+	}
+
 	response := ViewPostResponse{
 		Post:     post,
 		Comments: comments,
@@ -187,3 +446,18 @@ func ViewPost(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
+
+// requireVisiblePost 404s unless the caller can see the post, so posts they
+// aren't allowed to see look the same as ones that don't exist
+func requireVisiblePost(w http.ResponseWriter, r *http.Request, postID int) bool {
+	visible, err := visibility.CanView(auth.CurrentUser(r), postID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return false
+	}
+	if !visible {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return false
+	}
+	return true
+}
@@ -2,12 +2,21 @@ package handlers
 
 import (
 	"database/sql"
-	"encoding/base64"
 	"encoding/json"
 	"net/http"
+	"slices"
+	"strconv"
 	"time"
 
+	"github.com/BenH9999/CampusConnect/backend/internal/account"
+	"github.com/BenH9999/CampusConnect/backend/internal/auth"
+	"github.com/BenH9999/CampusConnect/backend/internal/avatar"
 	"github.com/BenH9999/CampusConnect/backend/internal/db"
+	"github.com/BenH9999/CampusConnect/backend/internal/linkpreview"
+	"github.com/BenH9999/CampusConnect/backend/internal/media"
+	"github.com/BenH9999/CampusConnect/backend/internal/models"
+	"github.com/BenH9999/CampusConnect/backend/internal/polls"
+	"github.com/BenH9999/CampusConnect/backend/internal/visibility"
 )
 
 type UserProfile struct {
@@ -15,19 +24,32 @@ type UserProfile struct {
 	Email          string    `json:"email"`
 	DisplayName    string    `json:"display_name"`
 	ProfilePicture string    `json:"profile_picture"`
+	Affiliation    string    `json:"affiliation"`
 	CreatedAt      time.Time `json:"created_at"`
 	UpdatedAt      time.Time `json:"updated_at"`
 }
 
 type PostProfileItem struct {
-	ID             string    `json:"id"`
-	Username       string    `json:"username"`
-	DisplayName    string    `json:"display_name"`
-	ProfilePicture string    `json:"profile_picture"`
-	Content        string    `json:"content"`
-	CreatedAt      time.Time `json:"created_at"`
-	LikesCount     int       `json:"likes_count"`
-	CommentsCount  int       `json:"comments_count"`
+	ID             string     `json:"id"`
+	Username       string     `json:"username"`
+	DisplayName    string     `json:"display_name"`
+	ProfilePicture string     `json:"profile_picture"`
+	Content        string     `json:"content"`
+	CreatedAt      time.Time  `json:"created_at"`
+	EditedAt       *time.Time `json:"edited_at"`
+	LikesCount     int        `json:"likes_count"`
+	CommentsCount  int        `json:"comments_count"`
+	RepostsCount   int        `json:"reposts_count"`
+	QuotedPostID   *int       `json:"quoted_post_id"`
+
+	Visibility   models.Visibility `json:"visibility"`
+	IsBookmarked bool              `json:"is_bookmarked"`
+
+	Attachments []models.Attachment `json:"attachments"`
+	QuotedPost  *QuotedPost         `json:"quoted_post"`
+	Poll        *models.Poll        `json:"poll"`
+
+	LinkPreviews []models.LinkPreview `json:"link_previews"`
 }
 
 func GetUserProfile(w http.ResponseWriter, r *http.Request) {
@@ -38,9 +60,10 @@ func GetUserProfile(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var userProfile UserProfile
-	var rawProfilePic []byte
+	var avatarVersion string
+	var pinnedPostID sql.NullInt64
 	queryUser := `
-        SELECT username, email, display_name, profile_picture, created_at, updated_at
+        SELECT username, email, display_name, avatar_version, affiliation, created_at, updated_at, pinned_post_id
         FROM users
         WHERE username = $1
     `
@@ -49,37 +72,40 @@ func GetUserProfile(w http.ResponseWriter, r *http.Request) {
 		&userProfile.Username,
 		&userProfile.Email,
 		&userProfile.DisplayName,
-		&rawProfilePic,
+		&avatarVersion,
+		&userProfile.Affiliation,
 		&userProfile.CreatedAt,
 		&userProfile.UpdatedAt,
+		&pinnedPostID,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			http.Error(w, "User not found", http.StatusNotFound)
+			redirectRenamedUser(w, r, username)
 			return
 		}
 		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	if len(rawProfilePic) > 0 {
-		userProfile.ProfilePicture = "data:image/png;base64," + base64.StdEncoding.EncodeToString(rawProfilePic)
-	} else {
-		userProfile.ProfilePicture = ""
-	}
+	userProfile.ProfilePicture = avatar.URL(userProfile.Username, avatarVersion, avatar.SizeLarge)
 
 	queryPosts := `
 	    SELECT 
 	        p.id,
 	        p.content,
 	        p.created_at,
+	        p.edited_at,
 	        (SELECT COUNT(*) FROM likes l WHERE l.post_id = p.id) AS likes_count,
-	        (SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id) AS comments_count
+	        (SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id) AS comments_count,
+	        (SELECT COUNT(*) FROM reposts rp WHERE rp.post_id = p.id) AS reposts_count,
+	        p.quoted_post_id,
+	        p.visibility
 	    FROM posts p
-	    WHERE p.username = $1
+	    WHERE p.username = $1 AND p.published AND ` + visibility.Clause("p", "$2") + `
 	    ORDER BY p.created_at DESC;
 	`
-	rows, err := db.DB.Query(queryPosts, username)
+	viewer := auth.CurrentUser(r)
+	rows, err := db.DB.Query(queryPosts, userProfile.Username, viewer)
 	if err != nil {
 		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -89,7 +115,7 @@ func GetUserProfile(w http.ResponseWriter, r *http.Request) {
 	var posts []PostProfileItem
 	for rows.Next() {
 		var post PostProfileItem
-		err := rows.Scan(&post.ID, &post.Content, &post.CreatedAt, &post.LikesCount, &post.CommentsCount)
+		err := rows.Scan(&post.ID, &post.Content, &post.CreatedAt, &post.EditedAt, &post.LikesCount, &post.CommentsCount, &post.RepostsCount, &post.QuotedPostID, &post.Visibility)
 		if err != nil {
 			http.Error(w, "Error scanning post: "+err.Error(), http.StatusInternalServerError)
 			return
@@ -97,12 +123,80 @@ func GetUserProfile(w http.ResponseWriter, r *http.Request) {
 		posts = append(posts, post)
 	}
 
+	ids := make([]int, 0, len(posts))
+	for _, post := range posts {
+		if id, err := strconv.Atoi(post.ID); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	attachments, err := media.ForPosts(ids)
+	if err != nil {
+		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	postPolls, err := polls.ForPosts(ids, viewer)
+	if err != nil {
+		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	previews, err := linkpreview.ForPosts(ids)
+	if err != nil {
+		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	bookmarked, err := bookmarkedPosts(ids, viewer)
+	if err != nil {
+		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for i := range posts {
+		id, _ := strconv.Atoi(posts[i].ID)
+		posts[i].Attachments = withoutNil(attachments[id])
+		posts[i].Poll = postPolls[id]
+		posts[i].LinkPreviews = withoutNil(previews[id])
+		posts[i].IsBookmarked = bookmarked[id]
+	}
+
+	var quotedIDs []int
+	for _, post := range posts {
+		if post.QuotedPostID != nil {
+			quotedIDs = append(quotedIDs, *post.QuotedPostID)
+		}
+	}
+	quoted, err := quotedPosts(quotedIDs, viewer)
+	if err != nil {
+		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for i := range posts {
+		if posts[i].QuotedPostID != nil {
+			posts[i].QuotedPost = quoted[*posts[i].QuotedPostID]
+		}
+	}
+
+	// The pinned post is taken out of the chronological list so it's only
+	// shown once. It's left out if the viewer can't see it.
+	var pinned *PostProfileItem
+	if pinnedPostID.Valid {
+		pinnedID := strconv.FormatInt(pinnedPostID.Int64, 10)
+		for i := range posts {
+			if posts[i].ID == pinnedID {
+				item := posts[i]
+				pinned = &item
+				posts = slices.Delete(posts, i, i+1)
+				break
+			}
+		}
+	}
+
 	response := struct {
-		User  UserProfile       `json:"user"`
-		Posts []PostProfileItem `json:"posts"`
+		User       UserProfile       `json:"user"`
+		PinnedPost *PostProfileItem  `json:"pinned_post"`
+		Posts      []PostProfileItem `json:"posts"`
 	}{
-		User:  userProfile,
-		Posts: posts,
+		User:       userProfile,
+		PinnedPost: pinned,
+		Posts:      posts,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -112,3 +206,43 @@ func GetUserProfile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// redirectRenamedUser sends a lookup by an old username on to the same URL
+// with the account's current name, or 404s if the name was never renamed
+func redirectRenamedUser(w http.ResponseWriter, r *http.Request, username string) {
+	current, err := account.ResolveUsername(username)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if current == "" {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	query.Set("username", current)
+	target := *r.URL
+	target.RawQuery = query.Encode()
+	http.Redirect(w, r, target.RequestURI(), http.StatusFound)
+}
+
+// GetMyRoles returns the caller's roles and what they allow
+func GetMyRoles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	roles, err := auth.Roles(auth.CurrentUser(r))
+	if err != nil {
+		http.Error(w, "Failed to fetch roles", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"roles":       roles,
+		"permissions": auth.Permissions(roles),
+	})
+}
@@ -4,62 +4,96 @@ import (
 	"database/sql"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
+	"strconv"
 	"strings"
 
+	"github.com/BenH9999/CampusConnect/backend/internal/auth"
+	"github.com/BenH9999/CampusConnect/backend/internal/avatar"
+	"github.com/BenH9999/CampusConnect/backend/internal/config"
 	"github.com/BenH9999/CampusConnect/backend/internal/db"
+	"github.com/BenH9999/CampusConnect/backend/internal/imaging"
+	"github.com/BenH9999/CampusConnect/backend/internal/validation"
 )
 
 type UpdateProfileInput struct {
-	Username       string `json:"username"`
 	DisplayName    string `json:"display_name"`
 	ProfilePicture string `json:"profile_picture"`
 }
 
+// UpdateUserProfile sets the display name and, if one is sent, a new profile
+// picture. Pictures are normalized before they're stored; leaving
+// profile_picture empty keeps the current one.
 func UpdateUserProfile(w http.ResponseWriter, r *http.Request) {
+	// Base64 adds a third to the picture's size
+	r.Body = http.MaxBytesReader(w, r.Body, config.GetMaxAvatarBytes()*4/3+64<<10)
+
 	var input UpdateProfileInput
 	err := json.NewDecoder(r.Body).Decode(&input)
 	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "Profile picture is too large", http.StatusRequestEntityTooLarge)
+			return
+		}
 		http.Error(w, "Invalid json body", http.StatusBadRequest)
 		return
 	}
 
-	var rawPic []byte
+	var errs validation.Errors
+	errs.DisplayName("display_name", input.DisplayName)
+
+	var picture []byte
 	if input.ProfilePicture != "" {
-		data := input.ProfilePicture
-		if strings.HasPrefix(data, "data:image") {
-			parts := strings.SplitN(data, ",", 2)
-			if len(parts) == 2 {
-				data = parts[1]
-			}
+		picture, err = decodeProfilePicture(input.ProfilePicture)
+		switch {
+		case errors.Is(err, avatar.ErrTooLarge):
+			errs.Add("profile_picture", validation.CodeTooLarge,
+				"Profile picture must be at most "+strconv.FormatInt(config.GetMaxAvatarBytes()>>20, 10)+" MB and "+strconv.Itoa(imaging.MaxDimension)+" pixels across")
+		case err != nil:
+			errs.Add("profile_picture", validation.CodeInvalidFormat, "Profile picture must be a JPEG, PNG or GIF image")
 		}
-		pic, err := base64.StdEncoding.DecodeString(data)
-		if err != nil {
-			http.Error(w, "Invalid base64 image data", http.StatusBadRequest)
-			return
-		}
-		rawPic = pic
+	}
+	if errs.Any() {
+		writeValidationErrors(w, errs)
+		return
 	}
 
 	query := `
         UPDATE users
         SET display_name = $1,
-            profile_picture = $2
+            profile_picture = COALESCE($2, profile_picture)
         WHERE username = $3
         RETURNING username
     `
 
 	var updatedUsername string
-	err = db.DB.QueryRow(query, input.DisplayName, rawPic, input.Username).Scan(&updatedUsername)
+	err = db.DB.QueryRow(query, strings.TrimSpace(input.DisplayName), picture, auth.CurrentUser(r)).Scan(&updatedUsername)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			http.Error(w, "User not found", http.StatusNotFound)
 			return
 		}
-		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		log.Println("Error updating profile:", err)
+		http.Error(w, "Failed to update profile", http.StatusInternalServerError)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(`{"message":"Profile updated successfully"}`))
 }
+
+// decodeProfilePicture accepts plain base64 or a data: URI and returns the
+// normalized image
+func decodeProfilePicture(data string) ([]byte, error) {
+	if strings.HasPrefix(data, "data:") {
+		_, data, _ = strings.Cut(data, ",")
+	}
+	raw, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, avatar.ErrInvalidImage
+	}
+	return avatar.Normalize(raw)
+}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BenH9999/CampusConnect/backend/internal/auth"
+	"github.com/BenH9999/CampusConnect/backend/internal/avatar"
+	"github.com/BenH9999/CampusConnect/backend/internal/db"
+	"github.com/BenH9999/CampusConnect/backend/internal/media"
+	"github.com/BenH9999/CampusConnect/backend/internal/models"
+	"github.com/BenH9999/CampusConnect/backend/internal/utils"
+	"github.com/BenH9999/CampusConnect/backend/internal/visibility"
+)
+
+type ToggleRepostRequest struct {
+	PostID int `json:"post_id"`
+}
+
+type RepostResponse struct {
+	IsReposted bool `json:"is_reposted"`
+	Count      int  `json:"count"`
+}
+
+// RepostInfo says who put a post in the feed when it arrived as a repost
+type RepostInfo struct {
+	Username    string    `json:"username"`
+	DisplayName string    `json:"display_name"`
+	RepostedAt  time.Time `json:"reposted_at"`
+}
+
+// QuotedPost is the post embedded in a quote post
+type QuotedPost struct {
+	ID             int        `json:"id"`
+	Username       string     `json:"username"`
+	DisplayName    string     `json:"display_name"`
+	ProfilePicture string     `json:"profile_picture"`
+	Content        string     `json:"content"`
+	CreatedAt      time.Time  `json:"created_at"`
+	EditedAt       *time.Time `json:"edited_at"`
+
+	Attachments []models.Attachment `json:"attachments"`
+}
+
+// CheckRepostStatus checks if a user has reposted a post
+func CheckRepostStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	postID, err := strconv.Atoi(r.URL.Query().Get("post_id"))
+	if err != nil {
+		http.Error(w, "post_id parameter is required", http.StatusBadRequest)
+		return
+	}
+	if !requireVisiblePost(w, r, postID) {
+		return
+	}
+
+	var response RepostResponse
+	err = db.DB.QueryRow(`
+		SELECT
+			EXISTS(SELECT 1 FROM reposts WHERE post_id = $1 AND username = $2),
+			(SELECT COUNT(*) FROM reposts WHERE post_id = $1)
+	`, postID, auth.CurrentUser(r)).Scan(&response.IsReposted, &response.Count)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// ToggleRepost reposts a post to the user's followers, or undoes the repost
+func ToggleRepost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ToggleRepostRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.PostID == 0 {
+		http.Error(w, "post_id is required", http.StatusBadRequest)
+		return
+	}
+
+	if !requireVisiblePost(w, r, req.PostID) {
+		return
+	}
+
+	// Authors can see their own drafts, but there's nothing to repost yet
+	var published bool
+	if err := db.DB.QueryRow(`SELECT published FROM posts WHERE id = $1`, req.PostID).Scan(&published); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !published {
+		http.Error(w, "Drafts and scheduled posts can't be reposted", http.StatusBadRequest)
+		return
+	}
+
+	username := auth.CurrentUser(r)
+
+	result, err := db.DB.Exec(`DELETE FROM reposts WHERE post_id = $1 AND username = $2`, req.PostID, username)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	removed, _ := result.RowsAffected()
+
+	if removed == 0 {
+		_, err = db.DB.Exec(`
+			INSERT INTO reposts (username, post_id) VALUES ($1, $2)
+			ON CONFLICT DO NOTHING
+		`, username, req.PostID)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		utils.CreateRepostNotification(req.PostID, username)
+	}
+
+	response := RepostResponse{IsReposted: removed == 0}
+	err = db.DB.QueryRow(`SELECT COUNT(*) FROM reposts WHERE post_id = $1`, req.PostID).Scan(&response.Count)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// quotedPosts loads the posts embedded by quote posts, keyed by ID. Posts
+// that have been deleted or that the viewer can't see are missing from the
+// map.
+func quotedPosts(postIDs []int, viewer string) (map[int]*QuotedPost, error) {
+	byID := make(map[int]*QuotedPost)
+	if len(postIDs) == 0 {
+		return byID, nil
+	}
+
+	ids := make([]string, len(postIDs))
+	for i, id := range postIDs {
+		ids[i] = strconv.Itoa(id)
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT p.id, p.username, u.display_name, u.avatar_version, p.content, p.created_at, p.edited_at
+		FROM posts p
+		JOIN users u ON p.username = u.username
+		WHERE p.id = ANY(string_to_array($1, ',')::int[]) AND `+visibility.Clause("p", "$2")+`
+	`, strings.Join(ids, ","), viewer)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var q QuotedPost
+		var avatarVersion string
+		if err := rows.Scan(&q.ID, &q.Username, &q.DisplayName, &avatarVersion, &q.Content, &q.CreatedAt, &q.EditedAt); err != nil {
+			return nil, err
+		}
+		q.ProfilePicture = avatar.URL(q.Username, avatarVersion, avatar.SizeMedium)
+		byID[q.ID] = &q
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	attachments, err := media.ForPosts(postIDs)
+	if err != nil {
+		return nil, err
+	}
+	for id, q := range byID {
+		q.Attachments = withoutNil(attachments[id])
+	}
+	return byID, nil
+}
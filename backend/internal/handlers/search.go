@@ -1,11 +1,11 @@
 package handlers
 
 import (
-	"encoding/base64"
 	"encoding/json"
 	"net/http"
 	"strings"
 
+	"github.com/BenH9999/CampusConnect/backend/internal/avatar"
 	"github.com/BenH9999/CampusConnect/backend/internal/db"
 )
 
@@ -27,7 +27,7 @@ func SearchUsers(w http.ResponseWriter, r *http.Request) {
 	searchQuery := "%" + strings.ToLower(query) + "%"
 
 	rows, err := db.DB.Query(`
-        SELECT username, display_name, profile_picture, email 
+        SELECT username, display_name, avatar_version, email 
         FROM users 
         WHERE LOWER(username) LIKE $1 OR LOWER(display_name) LIKE $1
     `, searchQuery)
@@ -40,19 +40,13 @@ func SearchUsers(w http.ResponseWriter, r *http.Request) {
 	var results []UserResult
 	for rows.Next() {
 		var u UserResult
-		var rawPic []byte
-		err := rows.Scan(&u.Username, &u.DisplayName, &rawPic, &u.Email)
+		var avatarVersion string
+		err := rows.Scan(&u.Username, &u.DisplayName, &avatarVersion, &u.Email)
 		if err != nil {
 			http.Error(w, "Error scanning user: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
-
-		if len(rawPic) > 0 {
-			encoded := base64.StdEncoding.EncodeToString(rawPic)
-			u.ProfilePicture = "data:image/png;base64," + encoded
-		} else {
-			u.ProfilePicture = ""
-		}
+		u.ProfilePicture = avatar.URL(u.Username, avatarVersion, avatar.SizeMedium)
 
 		results = append(results, u)
 	}
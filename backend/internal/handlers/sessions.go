@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/BenH9999/CampusConnect/backend/internal/auth"
+)
+
+type RefreshTokenInput struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type RevokeSessionInput struct {
+	ID int64 `json:"id"`
+}
+
+// RefreshToken exchanges a refresh token for a new access and refresh token
+func RefreshToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input RefreshTokenInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.RefreshToken == "" {
+		http.Error(w, "refresh_token is required", http.StatusBadRequest)
+		return
+	}
+
+	tokens, err := auth.RefreshSession(input.RefreshToken, clientIP(r))
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidRefreshToken) || errors.Is(err, auth.ErrRefreshTokenReused) {
+			http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, "Failed to refresh session", http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]string{}
+	addTokenFields(response, tokens)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetSessions lists the caller's active sessions
+func GetSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sessions, err := auth.ListSessions(auth.CurrentUser(r))
+	if err != nil {
+		http.Error(w, "Failed to fetch sessions", http.StatusInternalServerError)
+		return
+	}
+
+	current := auth.CurrentSession(r)
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == current
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessions)
+}
+
+// RevokeSession signs out one of the caller's sessions
+func RevokeSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input RevokeSessionInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.ID == 0 {
+		http.Error(w, "Session id is required", http.StatusBadRequest)
+		return
+	}
+
+	revoked, err := auth.RevokeSession(auth.CurrentUser(r), input.ID)
+	if err != nil {
+		http.Error(w, "Failed to revoke session", http.StatusInternalServerError)
+		return
+	}
+	if !revoked {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
+
+// RevokeAllSessions signs out every session for the caller. Passing
+// ?keep_current=true leaves the session making the request signed in.
+func RevokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var except int64
+	if r.URL.Query().Get("keep_current") == "true" {
+		except = auth.CurrentSession(r)
+	}
+
+	count, err := auth.RevokeAllSessions(auth.CurrentUser(r), except)
+	if err != nil {
+		http.Error(w, "Failed to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int64{"revoked": count})
+}
+
+// addTokenFields copies a token pair into a JSON response
+func addTokenFields(response map[string]string, tokens *auth.TokenPair) {
+	response["access_token"] = tokens.AccessToken
+	response["token_type"] = "Bearer"
+	response["expires_at"] = tokens.AccessExpiresAt.UTC().Format(time.RFC3339)
+	response["refresh_token"] = tokens.RefreshToken
+	response["refresh_expires_at"] = tokens.RefreshExpiresAt.UTC().Format(time.RFC3339)
+}
+
+func sessionInfo(r *http.Request, deviceName string) auth.SessionInfo {
+	if runes := []rune(deviceName); len(runes) > 100 {
+		deviceName = string(runes[:100])
+	}
+	return auth.SessionInfo{
+		DeviceName: deviceName,
+		IPAddress:  clientIP(r),
+		UserAgent:  r.UserAgent(),
+	}
+}
+
+// clientIP returns the address of the connecting client without the port
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
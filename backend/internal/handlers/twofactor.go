@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/BenH9999/CampusConnect/backend/internal/auth"
+	"github.com/BenH9999/CampusConnect/backend/internal/db"
+	"github.com/BenH9999/CampusConnect/backend/internal/models"
+	"github.com/BenH9999/CampusConnect/backend/internal/throttle"
+)
+
+type TwoFactorCodeInput struct {
+	Code string `json:"code"`
+}
+
+type DisableTwoFactorInput struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+type TwoFactorLoginInput struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+}
+
+// EnrollTwoFactor creates a new TOTP secret for the caller to add to their authenticator app
+func EnrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	secret, uri, err := auth.BeginTOTPEnrollment(auth.CurrentUser(r))
+	if err != nil {
+		if errors.Is(err, auth.ErrTwoFactorEnabled) {
+			http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Failed to start enrollment", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"secret":      secret,
+		"otpauth_uri": uri,
+	})
+}
+
+// ConfirmTwoFactor turns 2FA on once the caller proves their app produces
+// valid codes, and returns their recovery codes
+func ConfirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input TwoFactorCodeInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Code == "" {
+		http.Error(w, "code is required", http.StatusBadRequest)
+		return
+	}
+
+	codes, err := auth.ConfirmTOTPEnrollment(auth.CurrentUser(r), input.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrTwoFactorEnabled):
+			http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		case errors.Is(err, auth.ErrNoPendingEnrollment):
+			http.Error(w, "Start enrollment first", http.StatusBadRequest)
+		case errors.Is(err, auth.ErrInvalidCode):
+			http.Error(w, "Invalid code", http.StatusBadRequest)
+		default:
+			http.Error(w, "Failed to enable two-factor authentication", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]string{"recovery_codes": codes})
+}
+
+// DisableTwoFactor turns 2FA off. It needs both the password and a current
+// code so a stolen session alone can't remove the second factor.
+func DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input DisableTwoFactorInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Password == "" || input.Code == "" {
+		http.Error(w, "password and code are required", http.StatusBadRequest)
+		return
+	}
+
+	username := auth.CurrentUser(r)
+	if !checkSecondFactor(w, username, input.Code, input.Password) {
+		return
+	}
+
+	if err := auth.DisableTOTP(username); err != nil {
+		if errors.Is(err, auth.ErrTwoFactorNotEnabled) {
+			http.Error(w, "Two-factor authentication is not enabled", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Failed to disable two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
+
+// RegenerateRecoveryCodes replaces the caller's recovery codes after checking a current code
+func RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input TwoFactorCodeInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Code == "" {
+		http.Error(w, "code is required", http.StatusBadRequest)
+		return
+	}
+
+	username := auth.CurrentUser(r)
+	if !checkSecondFactor(w, username, input.Code, "") {
+		return
+	}
+
+	codes, err := auth.RegenerateRecoveryCodes(username)
+	if err != nil {
+		http.Error(w, "Failed to regenerate recovery codes", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]string{"recovery_codes": codes})
+}
+
+// GetTwoFactorStatus reports whether 2FA is on for the caller and how many recovery codes are left
+func GetTwoFactorStatus(w http.ResponseWriter, r *http.Request) {
+	username := auth.CurrentUser(r)
+
+	var enabled bool
+	err := db.DB.QueryRow(`SELECT totp_enabled_at IS NOT NULL FROM users WHERE username = $1`, username).Scan(&enabled)
+	if err != nil {
+		http.Error(w, "Failed to fetch two-factor status", http.StatusInternalServerError)
+		return
+	}
+
+	remaining, err := auth.RemainingRecoveryCodes(username)
+	if err != nil {
+		http.Error(w, "Failed to fetch two-factor status", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"enabled":                  enabled,
+		"recovery_codes_remaining": remaining,
+	})
+}
+
+// LoginTwoFactor completes a login started by Login for a user with 2FA on
+func LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input TwoFactorLoginInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.ChallengeToken == "" || input.Code == "" {
+		http.Error(w, "challenge_token and code are required", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := auth.ParseTwoFactorChallenge(input.ChallengeToken)
+	if err != nil {
+		http.Error(w, "Login challenge is invalid or has expired, please log in again", http.StatusUnauthorized)
+		return
+	}
+
+	if !checkSecondFactor(w, claims.Subject, input.Code, "") {
+		return
+	}
+
+	var user models.User
+	err = db.DB.QueryRow(`
+		SELECT username, email, display_name, avatar_version, affiliation, deletion_scheduled_for FROM users WHERE username = $1
+	`, claims.Subject).Scan(&user.Username, &user.Email, &user.DisplayName, &user.AvatarVersion, &user.Affiliation, &user.DeletionScheduledFor)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	completeLogin(w, r, user, claims.Device)
+}
+
+// checkSecondFactor verifies a TOTP or recovery code, and the password too if
+// one is given, with failures throttled per user. It writes the error
+// response and returns false if the check fails.
+func checkSecondFactor(w http.ResponseWriter, username, code, password string) bool {
+	key := throttle.Key{Kind: throttle.KindTwoFactor, Value: username}
+
+	wait, err := throttle.Login.Wait(key)
+	if err != nil {
+		http.Error(w, "Failed to check attempts", http.StatusInternalServerError)
+		return false
+	}
+	if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		http.Error(w, "Too many failed attempts, please try again later", http.StatusTooManyRequests)
+		return false
+	}
+
+	fail := func(message string) bool {
+		if err := throttle.Login.Fail(key); err != nil {
+			log.Println("Error recording failed two-factor attempt:", err)
+		}
+		http.Error(w, message, http.StatusUnauthorized)
+		return false
+	}
+
+	if password != "" {
+		ok, err := auth.CheckPassword(username, password)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return false
+		}
+		if !ok {
+			return fail("Incorrect password")
+		}
+	}
+
+	if err := auth.VerifySecondFactor(username, code); err != nil {
+		switch {
+		case errors.Is(err, auth.ErrInvalidCode):
+			return fail("Invalid code")
+		case errors.Is(err, auth.ErrTwoFactorNotEnabled):
+			http.Error(w, "Two-factor authentication is not enabled", http.StatusBadRequest)
+		default:
+			http.Error(w, "Failed to verify code", http.StatusInternalServerError)
+		}
+		return false
+	}
+
+	if err := throttle.Login.Reset(key.String()); err != nil {
+		log.Println("Error clearing two-factor attempts:", err)
+	}
+	return true
+}
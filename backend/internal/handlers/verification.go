@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/BenH9999/CampusConnect/backend/internal/auth"
+	"github.com/BenH9999/CampusConnect/backend/internal/config"
+	"github.com/BenH9999/CampusConnect/backend/internal/db"
+	"github.com/BenH9999/CampusConnect/backend/internal/mailer"
+)
+
+type ResendVerificationInput struct {
+	Email string `json:"email"`
+}
+
+// VerifyEmail confirms a user's email address from the signed link sent at registration
+func VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		http.Error(w, "token parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := auth.ParseVerificationToken(token)
+	if err != nil {
+		if errors.Is(err, auth.ErrExpiredToken) {
+			http.Error(w, "Verification link has expired, please request a new one", http.StatusGone)
+			return
+		}
+		http.Error(w, "Invalid verification link", http.StatusBadRequest)
+		return
+	}
+
+	// The email must still match, otherwise a link sent to an old address
+	// would verify a new one
+	result, err := db.DB.Exec(`
+		UPDATE users
+		SET email_verified_at = COALESCE(email_verified_at, NOW())
+		WHERE username = $1 AND email = $2
+	`, claims.Subject, claims.Email)
+	if err != nil {
+		http.Error(w, "Failed to verify email", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		http.Error(w, "Invalid verification link", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Email verified, you can now log in"})
+}
+
+// ResendVerification sends a fresh verification email, at most once per cooldown period
+func ResendVerification(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input ResendVerificationInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Email == "" {
+		http.Error(w, "email is required", http.StatusBadRequest)
+		return
+	}
+
+	// Same response whether or not the address is registered, so this can't
+	// be used to find out who has an account
+	response := map[string]string{"message": "If that account exists and is unverified, a new email has been sent"}
+
+	var username, email string
+	var verifiedAt, sentAt sql.NullTime
+	err := db.DB.QueryRow(`
+		SELECT username, email, email_verified_at, verification_sent_at
+		FROM users WHERE LOWER(email) = LOWER($1)
+	`, input.Email).Scan(&username, &email, &verifiedAt, &sentAt)
+	if err != nil && err != sql.ErrNoRows {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	// While the cooldown runs the request is quietly dropped, and send
+	// failures are only logged, so neither gives away that the account exists
+	coolingDown := sentAt.Valid && time.Now().Before(sentAt.Time.Add(config.GetVerificationResendCooldown()))
+	if err == nil && !verifiedAt.Valid && !coolingDown {
+		if err := sendVerificationEmail(username, email); err != nil {
+			log.Println("Error sending verification email:", err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// sendVerificationEmail emails the user a signed verification link and records when it was sent
+func sendVerificationEmail(username, email string) error {
+	token, err := auth.IssueVerificationToken(username, email)
+	if err != nil {
+		return err
+	}
+
+	link := config.GetPublicBaseURL() + "/api/verify-email?token=" + url.QueryEscape(token)
+	err = mailer.Send(mailer.Message{
+		To:      email,
+		Subject: "Verify your CampusConnect email",
+		Body: "Hi " + username + ",\n\n" +
+			"Please confirm your email address by opening the link below:\n\n" +
+			link + "\n\n" +
+			"The link expires in " + strconv.Itoa(int(config.GetEmailVerificationTTL().Hours())) + " hours. " +
+			"If you didn't create a CampusConnect account you can ignore this email.\n",
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = db.DB.Exec(`UPDATE users SET verification_sent_at = NOW() WHERE username = $1`, username)
+	return err
+}
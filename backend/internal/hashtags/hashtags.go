@@ -0,0 +1,140 @@
+// Package hashtags finds #tags in posts and works out which are trending
+package hashtags
+
+import (
+	"database/sql"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/BenH9999/CampusConnect/backend/internal/config"
+	"github.com/BenH9999/CampusConnect/backend/internal/db"
+	"github.com/BenH9999/CampusConnect/backend/internal/models"
+)
+
+const (
+	MaxTagLength   = 50
+	MaxTagsPerPost = 10
+	// trendingLimit is how many tags each trending snapshot keeps
+	trendingLimit = 20
+)
+
+// tagPattern matches a # that starts a word, so URL fragments, "C#" and
+// "##" aren't picked up
+var tagPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_#&/])#([\p{L}\p{N}_]+)`)
+
+// Parse returns the distinct tags in content, lowercased and without the #.
+// Tags need at least one letter, so "#1" isn't one.
+func Parse(content string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, m := range tagPattern.FindAllStringSubmatch(content, -1) {
+		tag, ok := Normalize(m[1])
+		if !ok || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+		if len(tags) == MaxTagsPerPost {
+			break
+		}
+	}
+	return tags
+}
+
+// Normalize cleans up a tag typed by a user, with or without the #. ok is
+// false if it isn't a valid tag.
+func Normalize(tag string) (normalized string, ok bool) {
+	tag = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+	if tag == "" || len(tag) > MaxTagLength {
+		return "", false
+	}
+	hasLetter := false
+	for _, r := range tag {
+		switch {
+		case unicode.IsLetter(r):
+			hasLetter = true
+		case unicode.IsDigit(r), r == '_':
+		default:
+			return "", false
+		}
+	}
+	return tag, hasLetter
+}
+
+// Save replaces the tags recorded for a post with the ones in content
+func Save(tx *sql.Tx, postID int, content string) error {
+	_, err := tx.Exec(`DELETE FROM post_hashtags WHERE post_id = $1`, postID)
+	if err != nil {
+		return err
+	}
+	for _, tag := range Parse(content) {
+		_, err = tx.Exec(`
+			INSERT INTO post_hashtags (post_id, tag, created_at)
+			SELECT id, $2, created_at FROM posts WHERE id = $1
+		`, postID, tag)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ComputeTrending rebuilds the trending snapshot from posts inside the
+// trending window. Tags are ranked by how many different people used them,
+// so one account repeating a tag can't push it up on its own. Only public
+// posts count: the list is shown to everyone signed in, including users
+// outside the university who can't see campus posts.
+func ComputeTrending() error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM trending_hashtags`)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO trending_hashtags (rank, tag, post_count, author_count)
+		SELECT ROW_NUMBER() OVER (ORDER BY author_count DESC, post_count DESC, tag), tag, post_count, author_count
+		FROM (
+			SELECT h.tag, COUNT(*) AS post_count, COUNT(DISTINCT p.username) AS author_count
+			FROM post_hashtags h
+			JOIN posts p ON p.id = h.post_id
+			WHERE h.created_at > NOW() - make_interval(secs => $1)
+				AND p.published AND p.visibility = 'public'
+			GROUP BY h.tag
+			ORDER BY author_count DESC, post_count DESC, h.tag
+			LIMIT $2
+		) counts
+	`, config.GetTrendingWindow().Seconds(), trendingLimit)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Trending returns the latest snapshot, most popular first
+func Trending() ([]models.TrendingTag, error) {
+	rows, err := db.DB.Query(`
+		SELECT tag, post_count, author_count, computed_at
+		FROM trending_hashtags
+		ORDER BY rank
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []models.TrendingTag{}
+	for rows.Next() {
+		var t models.TrendingTag
+		if err := rows.Scan(&t.Tag, &t.PostCount, &t.AuthorCount, &t.ComputedAt); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
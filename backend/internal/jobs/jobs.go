@@ -0,0 +1,39 @@
+package jobs
+
+import (
+	"log"
+	"time"
+
+	"github.com/BenH9999/CampusConnect/backend/internal/account"
+	"github.com/BenH9999/CampusConnect/backend/internal/hashtags"
+	"github.com/BenH9999/CampusConnect/backend/internal/linkpreview"
+	"github.com/BenH9999/CampusConnect/backend/internal/media"
+	"github.com/BenH9999/CampusConnect/backend/internal/polls"
+	"github.com/BenH9999/CampusConnect/backend/internal/publish"
+)
+
+// Start launches the background jobs. Each runs once straight away and then
+// on its own interval until the process exits.
+func Start() {
+	every("data exports", 10*time.Second, account.ProcessPendingExports)
+	every("expired data exports", time.Hour, account.PurgeExpiredExports)
+	every("account deletions", 10*time.Minute, account.PurgeDueAccounts)
+	every("orphaned attachments", time.Hour, media.PurgeOrphans)
+	every("trending hashtags", 5*time.Minute, hashtags.ComputeTrending)
+	every("scheduled posts", 30*time.Second, publish.Due)
+	every("closed polls", time.Minute, polls.NotifyClosed)
+	every("link previews", 5*time.Minute, linkpreview.FetchMissing)
+}
+
+func every(name string, interval time.Duration, run func() error) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := run(); err != nil {
+				log.Printf("Error running %s job: %v", name, err)
+			}
+			<-ticker.C
+		}
+	}()
+}
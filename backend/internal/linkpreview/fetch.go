@@ -0,0 +1,161 @@
+package linkpreview
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+
+	"github.com/BenH9999/CampusConnect/backend/internal/config"
+	"github.com/BenH9999/CampusConnect/backend/internal/models"
+)
+
+const (
+	// maxBodyBytes is how much of a page is read. The tags previews come
+	// from are in the head, so this is plenty.
+	maxBodyBytes = 512 << 10
+	maxRedirects = 3
+	userAgent    = "CampusConnectBot/1.0 (link previews)"
+)
+
+var (
+	ErrBadURL         = errors.New("only http and https URLs can be previewed")
+	ErrBlockedAddress = errors.New("address is not publicly routable")
+	ErrNotHTML        = errors.New("page is not HTML")
+	ErrNoPreview      = errors.New("page has no preview metadata")
+)
+
+// blockedPrefixes are ranges that aren't covered by the netip checks in
+// isPublic but still mustn't be reachable from the server
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("2002::/16"),
+}
+
+// Fetcher downloads pages and reads their preview metadata
+type Fetcher struct {
+	client *http.Client
+}
+
+// Default is the fetcher used for posts. It refuses to connect to private,
+// loopback and link-local addresses so links can't be used to probe the
+// server's own network.
+var Default = NewFetcher(config.GetLinkPreviewTimeout(), false)
+
+// NewFetcher returns a fetcher that gives up on a page after timeout.
+// allowPrivate turns off the address checks, which is only meant for tests
+// against a local server.
+func NewFetcher(timeout time.Duration, allowPrivate bool) *Fetcher {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		// Checking the address being connected to, rather than the one the
+		// hostname resolved to beforehand, also covers redirects and DNS
+		// that changes between lookups
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil || !isPublic(addrPort.Addr()) {
+				return ErrBlockedAddress
+			}
+			return nil
+		}
+	}
+
+	transport := &http.Transport{
+		// Never go through a proxy, which would hide the real destination
+		// from the dialer
+		Proxy:                  nil,
+		DialContext:            dialer.DialContext,
+		TLSHandshakeTimeout:    timeout,
+		ResponseHeaderTimeout:  timeout,
+		MaxResponseHeaderBytes: 64 << 10,
+		MaxIdleConns:           10,
+		IdleConnTimeout:        30 * time.Second,
+	}
+
+	return &Fetcher{
+		client: &http.Client{
+			Timeout:   timeout,
+			Transport: transport,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) > maxRedirects {
+					return errors.New("too many redirects")
+				}
+				if !allowedURL(req.URL) {
+					return ErrBadURL
+				}
+				return nil
+			},
+		},
+	}
+}
+
+// Fetch downloads the page at rawURL and returns its preview
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (models.LinkPreview, error) {
+	pageURL, err := url.Parse(rawURL)
+	if err != nil || !allowedURL(pageURL) {
+		return models.LinkPreview{}, ErrBadURL
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL.String(), nil)
+	if err != nil {
+		return models.LinkPreview{}, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return models.LinkPreview{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return models.LinkPreview{}, errors.New("unexpected status " + resp.Status)
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return models.LinkPreview{}, ErrNotHTML
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodyBytes))
+	if err != nil {
+		return models.LinkPreview{}, err
+	}
+
+	// Relative image URLs are relative to wherever redirects ended up
+	preview := parse(body, resp.Request.URL)
+	if preview.Title == "" {
+		return models.LinkPreview{}, ErrNoPreview
+	}
+	preview.URL = rawURL
+	return preview, nil
+}
+
+func allowedURL(u *url.URL) bool {
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && u.User == nil
+}
+
+// isPublic reports whether addr is somewhere on the public internet
+func isPublic(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
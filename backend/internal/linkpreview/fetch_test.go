@@ -0,0 +1,163 @@
+package linkpreview
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestFetcher returns a fetcher allowed to reach the local test servers
+func newTestFetcher() *Fetcher {
+	return NewFetcher(5*time.Second, true)
+}
+
+func serveHTML(body string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, body)
+	}))
+}
+
+func TestFetchReadsOpenGraphTags(t *testing.T) {
+	srv := serveHTML(`<!doctype html>
+<html><head>
+<title>Fallback title</title>
+<meta property="og:title" content="Freshers&#39; Fair">
+<meta property="og:description" content="  Stalls,   societies
+and free pizza ">
+<meta property="og:site_name" content="Students' Union">
+<meta property="og:image" content="/images/fair.png">
+<meta name="twitter:title" content="Twitter title">
+</head><body><meta property="og:title" content="In the body"></body></html>`)
+	defer srv.Close()
+
+	preview, err := newTestFetcher().Fetch(context.Background(), srv.URL+"/events/fair")
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+
+	if preview.URL != srv.URL+"/events/fair" {
+		t.Errorf("URL = %q, want the link as posted", preview.URL)
+	}
+	if preview.Title != "Freshers' Fair" {
+		t.Errorf("Title = %q, want the og:title", preview.Title)
+	}
+	if preview.Description != "Stalls, societies and free pizza" {
+		t.Errorf("Description = %q, want it with whitespace collapsed", preview.Description)
+	}
+	if preview.SiteName != "Students' Union" {
+		t.Errorf("SiteName = %q", preview.SiteName)
+	}
+	if preview.ImageURL != srv.URL+"/images/fair.png" {
+		t.Errorf("ImageURL = %q, want it resolved against the page", preview.ImageURL)
+	}
+}
+
+func TestFetchFallsBackToTwitterTags(t *testing.T) {
+	srv := serveHTML(`<html><head>
+<title>Page title</title>
+<meta name="twitter:title" content='Library opening hours'>
+<meta name="twitter:description" content="Open late during exams">
+<meta name="twitter:image" content="https://cdn.example.com/library.jpg">
+</head></html>`)
+	defer srv.Close()
+
+	preview, err := newTestFetcher().Fetch(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+
+	if preview.Title != "Library opening hours" {
+		t.Errorf("Title = %q, want the twitter:title over <title>", preview.Title)
+	}
+	if preview.Description != "Open late during exams" {
+		t.Errorf("Description = %q", preview.Description)
+	}
+	if preview.ImageURL != "https://cdn.example.com/library.jpg" {
+		t.Errorf("ImageURL = %q", preview.ImageURL)
+	}
+	if preview.SiteName != "127.0.0.1" {
+		t.Errorf("SiteName = %q, want the hostname without og:site_name", preview.SiteName)
+	}
+}
+
+func TestFetchReadsAtMostMaxBodyBytes(t *testing.T) {
+	// The only tags are past the end of what is read
+	padding := "<!--" + strings.Repeat("x", maxBodyBytes) + "-->"
+	srv := serveHTML(`<html><head>` + padding + `<meta property="og:title" content="Too far down"></head></html>`)
+	defer srv.Close()
+
+	_, err := newTestFetcher().Fetch(context.Background(), srv.URL)
+	if !errors.Is(err, ErrNoPreview) {
+		t.Errorf("Fetch error = %v, want ErrNoPreview", err)
+	}
+}
+
+func TestFetchRejectsNonHTML(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"title": "<meta property=\"og:title\" content=\"Not a page\">"}`)
+	}))
+	defer srv.Close()
+
+	_, err := newTestFetcher().Fetch(context.Background(), srv.URL)
+	if !errors.Is(err, ErrNotHTML) {
+		t.Errorf("Fetch error = %v, want ErrNotHTML", err)
+	}
+}
+
+func TestFetchFollowsLimitedRedirects(t *testing.T) {
+	// /hops/N redirects N more times before serving the page
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/hops/"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		if n > 0 {
+			http.Redirect(w, r, "/hops/"+strconv.Itoa(n-1), http.StatusFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<head><meta property="og:title" content="Arrived"></head>`)
+	}))
+	defer srv.Close()
+
+	preview, err := newTestFetcher().Fetch(context.Background(), srv.URL+"/hops/"+strconv.Itoa(maxRedirects))
+	if err != nil {
+		t.Fatalf("Fetch with %d redirects: %v", maxRedirects, err)
+	}
+	if preview.Title != "Arrived" {
+		t.Errorf("Title = %q", preview.Title)
+	}
+
+	_, err = newTestFetcher().Fetch(context.Background(), srv.URL+"/hops/"+strconv.Itoa(maxRedirects+1))
+	if err == nil || !strings.Contains(err.Error(), "too many redirects") {
+		t.Errorf("Fetch with %d redirects: error = %v, want too many redirects", maxRedirects+1, err)
+	}
+}
+
+func TestFetcherRefusesLoopback(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<head><meta property="og:title" content="Internal"></head>`)
+	}))
+	defer srv.Close()
+
+	_, err := NewFetcher(5*time.Second, false).Fetch(context.Background(), srv.URL)
+	if !errors.Is(err, ErrBlockedAddress) {
+		t.Errorf("Fetch error = %v, want ErrBlockedAddress", err)
+	}
+	if hits.Load() != 0 {
+		t.Errorf("server got %d requests, want none", hits.Load())
+	}
+}
@@ -0,0 +1,210 @@
+// Package linkpreview finds links in posts and unfurls them into previews
+// from the OpenGraph and Twitter card tags of the pages they point to.
+// Fetched previews are cached in link_previews and shared by every post
+// linking to the same URL.
+package linkpreview
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BenH9999/CampusConnect/backend/internal/config"
+	"github.com/BenH9999/CampusConnect/backend/internal/db"
+	"github.com/BenH9999/CampusConnect/backend/internal/models"
+)
+
+const (
+	// MaxLinksPerPost caps how many links in one post are previewed
+	MaxLinksPerPost = 3
+	maxURLLength    = 2048
+	// failedRetryAfter is how long a page that gave no preview waits before
+	// it is tried again
+	failedRetryAfter = time.Hour
+	// refreshWindow limits refetching stale previews to links in recent
+	// posts, so old posts don't keep the fetcher busy
+	refreshWindow = 7 * 24 * time.Hour
+	// fetchBatchSize caps how many pages one run of FetchMissing fetches
+	fetchBatchSize = 50
+)
+
+var urlPattern = regexp.MustCompile(`(?i)\bhttps?://[^\s<>"]+`)
+
+// Extract returns the distinct links in content, in order, up to
+// MaxLinksPerPost
+func Extract(content string) []string {
+	var links []string
+	seen := make(map[string]bool)
+	for _, link := range urlPattern.FindAllString(content, -1) {
+		link = trimLink(link)
+		if len(link) > maxURLLength || seen[link] {
+			continue
+		}
+		seen[link] = true
+		links = append(links, link)
+		if len(links) == MaxLinksPerPost {
+			break
+		}
+	}
+	return links
+}
+
+// trimLink drops punctuation that ends the sentence around a link rather
+// than the link itself, keeping closing brackets that have a partner inside
+// it, as in Wikipedia URLs
+func trimLink(link string) string {
+	for link != "" {
+		last := link[len(link)-1]
+		switch {
+		case strings.IndexByte(".,;:!?'*", last) >= 0:
+			link = link[:len(link)-1]
+		case last == ')' && strings.Count(link, "(") < strings.Count(link, ")"):
+			link = link[:len(link)-1]
+		case last == ']' && strings.Count(link, "[") < strings.Count(link, "]"):
+			link = link[:len(link)-1]
+		default:
+			return link
+		}
+	}
+	return link
+}
+
+// Save replaces the links stored for a post with those in its content and
+// returns them. The previews themselves are fetched separately, by Refresh
+// or the FetchMissing job, so saving a post never waits on other sites.
+func Save(tx *sql.Tx, postID int, content string) ([]string, error) {
+	_, err := tx.Exec(`DELETE FROM post_links WHERE post_id = $1`, postID)
+	if err != nil {
+		return nil, err
+	}
+
+	links := Extract(content)
+	for i, link := range links {
+		_, err := tx.Exec(`INSERT INTO post_links (post_id, position, url) VALUES ($1, $2, $3)`, postID, i, link)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return links, nil
+}
+
+// Refresh fetches previews for whichever of links aren't cached or are due
+// to be fetched again. It is meant to be run in the background after a post
+// is saved.
+func Refresh(links []string) {
+	for _, link := range links {
+		var due bool
+		err := db.DB.QueryRow(`
+			SELECT NOT EXISTS(
+				SELECT 1 FROM link_previews
+				WHERE url = $1 AND fetched_at > NOW() - make_interval(secs => CASE WHEN ok THEN $2 ELSE $3 END)
+			)
+		`, link, config.GetLinkPreviewTTL().Seconds(), failedRetryAfter.Seconds()).Scan(&due)
+		if err != nil {
+			log.Printf("Error checking link preview cache: %v", err)
+			return
+		}
+		if due {
+			fetch(link)
+		}
+	}
+}
+
+// FetchMissing fetches previews for links in posts that have never been
+// fetched, and refreshes stale ones in recent posts
+func FetchMissing() error {
+	rows, err := db.DB.Query(`
+		SELECT DISTINCT l.url
+		FROM post_links l
+		JOIN posts p ON p.id = l.post_id
+		LEFT JOIN link_previews lp ON lp.url = l.url
+		WHERE lp.url IS NULL
+			OR (p.created_at > NOW() - make_interval(secs => $1)
+				AND lp.fetched_at < NOW() - make_interval(secs => CASE WHEN lp.ok THEN $2 ELSE $3 END))
+		LIMIT $4
+	`, refreshWindow.Seconds(), config.GetLinkPreviewTTL().Seconds(), failedRetryAfter.Seconds(), fetchBatchSize)
+	if err != nil {
+		return err
+	}
+	var links []string
+	for rows.Next() {
+		var link string
+		if err := rows.Scan(&link); err != nil {
+			rows.Close()
+			return err
+		}
+		links = append(links, link)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, link := range links {
+		fetch(link)
+	}
+	return nil
+}
+
+// fetch unfurls a link with the Default fetcher and caches the result.
+// Failures are cached too, so a broken link isn't fetched for every post.
+func fetch(link string) {
+	ctx, cancel := context.WithTimeout(context.Background(), config.GetLinkPreviewTimeout())
+	defer cancel()
+
+	preview, fetchErr := Default.Fetch(ctx, link)
+	_, err := db.DB.Exec(`
+		INSERT INTO link_previews (url, ok, title, description, image_url, site_name, fetched_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW())
+		ON CONFLICT (url) DO UPDATE SET
+			ok = EXCLUDED.ok,
+			title = EXCLUDED.title,
+			description = EXCLUDED.description,
+			image_url = EXCLUDED.image_url,
+			site_name = EXCLUDED.site_name,
+			fetched_at = EXCLUDED.fetched_at
+	`, link, fetchErr == nil, preview.Title, preview.Description, preview.ImageURL, preview.SiteName)
+	if err != nil {
+		log.Printf("Error caching link preview: %v", err)
+	}
+}
+
+// ForPosts returns the previews for the links in each post, keyed by post
+// ID. Links without a successful preview yet are left out.
+func ForPosts(postIDs []int) (map[int][]models.LinkPreview, error) {
+	byPost := make(map[int][]models.LinkPreview)
+	if len(postIDs) == 0 {
+		return byPost, nil
+	}
+
+	ids := make([]string, len(postIDs))
+	for i, id := range postIDs {
+		ids[i] = strconv.Itoa(id)
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT l.post_id, lp.url, lp.title, lp.description, lp.image_url, lp.site_name
+		FROM post_links l
+		JOIN link_previews lp ON lp.url = l.url AND lp.ok
+		WHERE l.post_id = ANY(string_to_array($1, ',')::int[])
+		ORDER BY l.post_id, l.position
+	`, strings.Join(ids, ","))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var postID int
+		var p models.LinkPreview
+		if err := rows.Scan(&postID, &p.URL, &p.Title, &p.Description, &p.ImageURL, &p.SiteName); err != nil {
+			return nil, err
+		}
+		byPost[postID] = append(byPost[postID], p)
+	}
+	return byPost, rows.Err()
+}
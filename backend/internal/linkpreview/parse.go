@@ -0,0 +1,111 @@
+package linkpreview
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/BenH9999/CampusConnect/backend/internal/models"
+)
+
+const (
+	maxTitleLength       = 300
+	maxDescriptionLength = 1000
+	maxSiteNameLength    = 100
+	maxImageURLLength    = 2048
+)
+
+var (
+	metaTagPattern   = regexp.MustCompile(`(?is)<meta\s(?:[^>"']|"[^"]*"|'[^']*')*>`)
+	attributePattern = regexp.MustCompile(`(?is)([a-z][a-z0-9:_-]*)\s*=\s*("[^"]*"|'[^']*'|[^\s"'>]+)`)
+	titlePattern     = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	headEndPattern   = regexp.MustCompile(`(?i)</head\s*>`)
+)
+
+// parse reads the OpenGraph and Twitter card tags in a page, falling back to
+// its <title> and description meta tag. Tags are matched with regular
+// expressions rather than a full HTML parser, which is enough for the head of
+// a page.
+func parse(body []byte, pageURL *url.URL) models.LinkPreview {
+	page := strings.ToValidUTF8(string(body), "�")
+	if loc := headEndPattern.FindStringIndex(page); loc != nil {
+		page = page[:loc[0]]
+	}
+
+	// The first value for each key wins, as sites put the canonical one first
+	meta := make(map[string]string)
+	for _, tag := range metaTagPattern.FindAllString(page, -1) {
+		attrs := make(map[string]string)
+		for _, m := range attributePattern.FindAllStringSubmatch(tag, -1) {
+			attrs[strings.ToLower(m[1])] = unquote(m[2])
+		}
+		key := attrs["property"]
+		if key == "" {
+			key = attrs["name"]
+		}
+		key = strings.ToLower(key)
+		content := clean(attrs["content"])
+		if key == "" || content == "" {
+			continue
+		}
+		if _, ok := meta[key]; !ok {
+			meta[key] = content
+		}
+	}
+
+	preview := models.LinkPreview{
+		Title:       first(meta, "og:title", "twitter:title"),
+		Description: first(meta, "og:description", "twitter:description", "description"),
+		SiteName:    first(meta, "og:site_name"),
+	}
+	if preview.Title == "" {
+		if m := titlePattern.FindStringSubmatch(page); m != nil {
+			preview.Title = clean(m[1])
+		}
+	}
+	if preview.SiteName == "" {
+		preview.SiteName = pageURL.Hostname()
+	}
+
+	image := first(meta, "og:image:secure_url", "og:image", "og:image:url", "twitter:image", "twitter:image:src")
+	if ref, err := url.Parse(image); image != "" && err == nil {
+		if abs := pageURL.ResolveReference(ref); allowedURL(abs) && len(abs.String()) <= maxImageURLLength {
+			preview.ImageURL = abs.String()
+		}
+	}
+
+	preview.Title = truncate(preview.Title, maxTitleLength)
+	preview.Description = truncate(preview.Description, maxDescriptionLength)
+	preview.SiteName = truncate(preview.SiteName, maxSiteNameLength)
+	return preview
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+func first(meta map[string]string, keys ...string) string {
+	for _, key := range keys {
+		if v := meta[key]; v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// clean decodes HTML entities and collapses whitespace
+func clean(s string) string {
+	return strings.Join(strings.Fields(html.UnescapeString(s)), " ")
+}
+
+func truncate(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return strings.TrimSpace(string(runes[:max-1])) + "…"
+}
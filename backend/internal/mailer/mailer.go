@@ -0,0 +1,46 @@
+package mailer
+
+import (
+	"log"
+
+	"github.com/BenH9999/CampusConnect/backend/internal/config"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers email. Implementations must be safe for concurrent use.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// Default is the mailer used by the handlers, set up by Init
+var Default Mailer = NewLogMailer("")
+
+// Init selects the mailer implementation from the mail config
+func Init() {
+	cfg := config.GetMailConfig()
+
+	switch cfg.Driver {
+	case "smtp":
+		if cfg.SMTPHost == "" {
+			log.Fatal("MAIL_DRIVER is smtp but SMTP_HOST is not set")
+		}
+		Default = NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.From)
+		log.Println("Using SMTP mailer via", cfg.SMTPHost)
+	case "log":
+		Default = NewLogMailer(cfg.LogPath)
+		log.Println("Using log mailer, emails will not be delivered")
+	default:
+		log.Fatal("Unknown MAIL_DRIVER: ", cfg.Driver)
+	}
+}
+
+// Send delivers a message with the default mailer
+func Send(msg Message) error {
+	return Default.Send(msg)
+}
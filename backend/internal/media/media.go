@@ -0,0 +1,281 @@
+package media
+
+import (
+	"bytes"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BenH9999/CampusConnect/backend/internal/config"
+	"github.com/BenH9999/CampusConnect/backend/internal/db"
+	"github.com/BenH9999/CampusConnect/backend/internal/imaging"
+	"github.com/BenH9999/CampusConnect/backend/internal/models"
+	"github.com/BenH9999/CampusConnect/backend/internal/storage"
+	"github.com/BenH9999/CampusConnect/backend/internal/visibility"
+)
+
+const (
+	MaxAttachmentsPerPost = 4
+	AltTextMaxLength      = 1000
+	// orphanTTL is how long an upload can wait to be attached to a post
+	orphanTTL = 24 * time.Hour
+	// jpegQuality is used when re-encoding photos to strip their metadata
+	jpegQuality = 90
+)
+
+// allowedTypes are the sniffed content types accepted for upload
+var allowedTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"application/pdf": true,
+}
+
+var (
+	ErrUnsupportedType    = errors.New("unsupported file type")
+	ErrTooLarge           = errors.New("file is too large")
+	ErrBadImage           = errors.New("image could not be read or is too large")
+	ErrAltTextTooLong     = errors.New("alt text is too long")
+	ErrTooManyAttachments = errors.New("too many attachments")
+	ErrInvalidAttachment  = errors.New("attachment not found or already used")
+	ErrNotFound           = errors.New("attachment not found")
+)
+
+// Save stores an upload and records it as an attachment waiting to be added
+// to one of the user's posts. The type is sniffed from the content rather
+// than trusted from the client.
+func Save(username string, data []byte, altText string) (models.Attachment, error) {
+	if int64(len(data)) > config.GetMaxUploadBytes() {
+		return models.Attachment{}, ErrTooLarge
+	}
+	if len(altText) > AltTextMaxLength {
+		return models.Attachment{}, ErrAltTextTooLong
+	}
+
+	mimeType, _, _ := strings.Cut(http.DetectContentType(data), ";")
+	if !allowedTypes[mimeType] {
+		return models.Attachment{}, ErrUnsupportedType
+	}
+
+	var width, height int
+	if strings.HasPrefix(mimeType, "image/") {
+		var err error
+		if data, width, height, err = stripMetadata(data, mimeType); err != nil {
+			return models.Attachment{}, err
+		}
+	}
+
+	key, err := newKey()
+	if err != nil {
+		return models.Attachment{}, err
+	}
+	if err := storage.Default.Put(key, mimeType, data); err != nil {
+		return models.Attachment{}, err
+	}
+
+	att := models.Attachment{
+		MimeType:  mimeType,
+		AltText:   altText,
+		Width:     width,
+		Height:    height,
+		SizeBytes: int64(len(data)),
+	}
+	err = db.DB.QueryRow(`
+		INSERT INTO attachments (username, storage_key, mime_type, alt_text, width, height, size_bytes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at
+	`, username, key, mimeType, altText, width, height, att.SizeBytes).Scan(&att.ID, &att.CreatedAt)
+	if err != nil {
+		if delErr := storage.Default.Delete(key); delErr != nil {
+			log.Println("Error removing blob after failed insert:", delErr)
+		}
+		return models.Attachment{}, err
+	}
+	att.URL = URL(att.ID)
+	return att, nil
+}
+
+// Attach adds the user's unused uploads to a post, in the order given
+func Attach(tx *sql.Tx, postID int, username string, ids []int) error {
+	if len(ids) > MaxAttachmentsPerPost {
+		return ErrTooManyAttachments
+	}
+	for i, id := range ids {
+		result, err := tx.Exec(`
+			UPDATE attachments SET post_id = $1, position = $2, attached_at = NOW()
+			WHERE id = $3 AND username = $4 AND attached_at IS NULL
+		`, postID, i, id, username)
+		if err != nil {
+			return err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return ErrInvalidAttachment
+		}
+	}
+	return nil
+}
+
+// ForPosts returns the attachments of each post, keyed by post ID
+func ForPosts(postIDs []int) (map[int][]models.Attachment, error) {
+	byPost := make(map[int][]models.Attachment)
+	if len(postIDs) == 0 {
+		return byPost, nil
+	}
+
+	ids := make([]string, len(postIDs))
+	for i, id := range postIDs {
+		ids[i] = strconv.Itoa(id)
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT post_id, id, mime_type, alt_text, width, height, size_bytes, created_at
+		FROM attachments
+		WHERE post_id = ANY(string_to_array($1, ',')::int[])
+		ORDER BY post_id, position
+	`, strings.Join(ids, ","))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var postID int
+		var att models.Attachment
+		if err := rows.Scan(&postID, &att.ID, &att.MimeType, &att.AltText, &att.Width, &att.Height, &att.SizeBytes, &att.CreatedAt); err != nil {
+			return nil, err
+		}
+		att.URL = URL(att.ID)
+		byPost[postID] = append(byPost[postID], att)
+	}
+	return byPost, rows.Err()
+}
+
+// Open returns an attachment's content if the user may see it: attachments
+// on posts are visible to whoever can see the post, but an upload not yet on
+// a post is only visible to its uploader
+func Open(id int, username string) (io.ReadCloser, models.Attachment, string, error) {
+	var att models.Attachment
+	var key string
+	err := db.DB.QueryRow(`
+		SELECT a.id, a.storage_key, a.mime_type, a.alt_text, a.width, a.height, a.size_bytes, a.created_at
+		FROM attachments a
+		LEFT JOIN posts p ON p.id = a.post_id
+		WHERE a.id = $1 AND (
+			(p.id IS NOT NULL AND `+visibility.Clause("p", "$2")+`)
+			OR (a.attached_at IS NULL AND a.username = $2)
+		)
+	`, id, username).Scan(&att.ID, &key, &att.MimeType, &att.AltText, &att.Width, &att.Height, &att.SizeBytes, &att.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, att, "", ErrNotFound
+	}
+	if err != nil {
+		return nil, att, "", err
+	}
+
+	body, err := storage.Default.Get(key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, att, "", ErrNotFound
+	}
+	return body, att, key, err
+}
+
+// URL is where clients fetch an attachment from
+func URL(id int) string {
+	return config.GetPublicBaseURL() + "/api/media?id=" + strconv.Itoa(id)
+}
+
+// PurgeOrphans removes uploads that were never attached to a post, and
+// attachments left behind when their post or uploader was deleted. Those
+// rows are kept by the foreign keys (with post_id or username set to NULL)
+// rather than cascaded, so the blobs can be found and deleted here.
+func PurgeOrphans() error {
+	rows, err := db.DB.Query(`
+		SELECT id, storage_key FROM attachments
+		WHERE username IS NULL
+			OR (post_id IS NULL AND attached_at IS NOT NULL)
+			OR (post_id IS NULL AND created_at < NOW() - make_interval(secs => $1))
+	`, orphanTTL.Seconds())
+	if err != nil {
+		return err
+	}
+
+	type orphan struct {
+		id  int
+		key string
+	}
+	var orphans []orphan
+	for rows.Next() {
+		var o orphan
+		if err := rows.Scan(&o.id, &o.key); err != nil {
+			rows.Close()
+			return err
+		}
+		orphans = append(orphans, o)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, o := range orphans {
+		if err := storage.Default.Delete(o.key); err != nil {
+			return err
+		}
+		if _, err := db.DB.Exec(`DELETE FROM attachments WHERE id = $1`, o.id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stripMetadata re-encodes JPEG and PNG images from their decoded pixels,
+// which drops EXIF and any other metadata such as GPS location, and returns
+// the new data with its dimensions. Photos are turned upright first, as the
+// orientation tag is thrown away with the rest. GIFs are kept as they are so
+// animations survive.
+func stripMetadata(data []byte, mimeType string) ([]byte, int, int, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || cfg.Width > imaging.MaxDimension || cfg.Height > imaging.MaxDimension {
+		return nil, 0, 0, ErrBadImage
+	}
+	if mimeType == "image/gif" {
+		return data, cfg.Width, cfg.Height, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, 0, ErrBadImage
+	}
+
+	var buf bytes.Buffer
+	if mimeType == "image/jpeg" {
+		img = imaging.Orient(img, imaging.Orientation(data))
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	b := img.Bounds()
+	return buf.Bytes(), b.Dx(), b.Dy(), nil
+}
+
+func newKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	name := hex.EncodeToString(b)
+	return "attachments/" + name[:2] + "/" + name, nil
+}
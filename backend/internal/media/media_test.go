@@ -0,0 +1,153 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// gpsMarker stands in for location metadata a phone would write
+const gpsMarker = "GPSLatitude 51.5072N"
+
+func testImage(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			img.Set(x, y, color.RGBA{uint8(x * 40), uint8(y * 40), 200, 255})
+		}
+	}
+	return img
+}
+
+// withExif inserts an APP1 segment after the JPEG's start of image marker,
+// holding an orientation tag followed by gpsMarker
+func withExif(t *testing.T, jpg []byte, orientation uint16) []byte {
+	t.Helper()
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	tiff = binary.BigEndian.AppendUint16(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, 0x0112)
+	tiff = binary.BigEndian.AppendUint16(tiff, 3)
+	tiff = binary.BigEndian.AppendUint32(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0)
+	tiff = append(tiff, gpsMarker...)
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := []byte{0xFF, 0xE1}
+	app1 = binary.BigEndian.AppendUint16(app1, uint16(len(segment)+2))
+	app1 = append(app1, segment...)
+
+	out := append([]byte{}, jpg[:2]...)
+	out = append(out, app1...)
+	return append(out, jpg[2:]...)
+}
+
+// withText inserts a tEXt chunk after the PNG's header chunk
+func withText(png []byte, text string) []byte {
+	const afterIHDR = 8 + 25
+	data := []byte("Comment\x00" + text)
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	chunk = append(chunk, "tEXt"...)
+	chunk = append(chunk, data...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+
+	out := append([]byte{}, png[:afterIHDR]...)
+	out = append(out, chunk...)
+	return append(out, png[afterIHDR:]...)
+}
+
+func TestStripMetadataJPEG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, testImage(4, 2), nil); err != nil {
+		t.Fatal(err)
+	}
+	// Orientation 6: stored on its side, to be turned 90° clockwise
+	data := withExif(t, buf.Bytes(), 6)
+
+	out, width, height, err := stripMetadata(data, "image/jpeg")
+	if err != nil {
+		t.Fatalf("stripMetadata: %v", err)
+	}
+	if bytes.Contains(out, []byte("Exif")) || bytes.Contains(out, []byte(gpsMarker)) {
+		t.Error("EXIF data survived re-encoding")
+	}
+	if width != 2 || height != 4 {
+		t.Errorf("dimensions = %dx%d, want the upright 2x4", width, height)
+	}
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(out))
+	if err != nil {
+		t.Fatalf("output is not a JPEG: %v", err)
+	}
+	if cfg.Width != width || cfg.Height != height {
+		t.Errorf("encoded as %dx%d, reported %dx%d", cfg.Width, cfg.Height, width, height)
+	}
+}
+
+func TestStripMetadataPNG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage(3, 5)); err != nil {
+		t.Fatal(err)
+	}
+	data := withText(buf.Bytes(), gpsMarker)
+	if _, err := png.DecodeConfig(bytes.NewReader(data)); err != nil {
+		t.Fatalf("test PNG is invalid: %v", err)
+	}
+
+	out, width, height, err := stripMetadata(data, "image/png")
+	if err != nil {
+		t.Fatalf("stripMetadata: %v", err)
+	}
+	if bytes.Contains(out, []byte(gpsMarker)) {
+		t.Error("text chunk survived re-encoding")
+	}
+	if width != 3 || height != 5 {
+		t.Errorf("dimensions = %dx%d, want 3x5", width, height)
+	}
+}
+
+func TestStripMetadataKeepsGIF(t *testing.T) {
+	var buf bytes.Buffer
+	palette := color.Palette{color.Black, color.White}
+	anim := &gif.GIF{
+		Image: []*image.Paletted{image.NewPaletted(image.Rect(0, 0, 6, 4), palette), image.NewPaletted(image.Rect(0, 0, 6, 4), palette)},
+		Delay: []int{10, 10},
+	}
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		t.Fatal(err)
+	}
+
+	out, width, height, err := stripMetadata(buf.Bytes(), "image/gif")
+	if err != nil {
+		t.Fatalf("stripMetadata: %v", err)
+	}
+	if !bytes.Equal(out, buf.Bytes()) {
+		t.Error("GIF was re-encoded, which would lose its animation")
+	}
+	if width != 6 || height != 4 {
+		t.Errorf("dimensions = %dx%d, want 6x4", width, height)
+	}
+}
+
+func TestStripMetadataRejectsHugeImages(t *testing.T) {
+	// A valid header claiming a canvas far over the limit
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage(1, 1)); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	binary.BigEndian.PutUint32(data[16:], 100000)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+	if cfg, err := png.DecodeConfig(bytes.NewReader(data)); err != nil || cfg.Width != 100000 {
+		t.Fatalf("test PNG header is invalid: %v", err)
+	}
+
+	if _, _, _, err := stripMetadata(data, "image/png"); err != ErrBadImage {
+		t.Errorf("err = %v, want ErrBadImage", err)
+	}
+}
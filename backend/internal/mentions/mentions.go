@@ -0,0 +1,193 @@
+// Package mentions resolves @username mentions in posts and comments
+package mentions
+
+import (
+	"database/sql"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/BenH9999/CampusConnect/backend/internal/db"
+	"github.com/BenH9999/CampusConnect/backend/internal/models"
+	"github.com/BenH9999/CampusConnect/backend/internal/validation"
+)
+
+// MaxMentions caps how many people one post or comment can notify
+const MaxMentions = 10
+
+// mentionPattern matches an @ that starts a word followed by something shaped
+// like a username, so email addresses aren't picked up
+var mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_.@])@([A-Za-z0-9_]+(?:\.[A-Za-z0-9_]+)*)`)
+
+type candidate struct {
+	name       string
+	start, end int
+}
+
+// parse finds the @mentions in content. Offsets are in UTF-16 code units,
+// the way JavaScript indexes strings, so clients can slice the text directly.
+func parse(content string) []candidate {
+	var found []candidate
+	for _, m := range mentionPattern.FindAllStringSubmatchIndex(content, -1) {
+		// m[2]:m[3] is the username; the @ is the byte before it
+		name := content[m[2]:m[3]]
+		if len(name) > validation.UsernameMaxLength {
+			continue
+		}
+		start := utf16Len(content[:m[2]-1])
+		found = append(found, candidate{
+			name:  name,
+			start: start,
+			end:   start + 1 + len(name),
+		})
+	}
+	return found
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
+
+// Save resolves the mentions in a post's or comment's content to real users
+// and replaces the ones stored for it. Exactly one of postID and commentID
+// should be set. It returns the users who weren't mentioned before, who are
+// the ones to notify.
+func Save(tx *sql.Tx, postID, commentID *int, content string) ([]string, error) {
+	owner, id := "post_id", postID
+	if commentID != nil {
+		owner, id = "comment_id", commentID
+	}
+
+	previous := make(map[string]bool)
+	rows, err := tx.Query(`SELECT username FROM mentions WHERE `+owner+` = $1`, *id)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		previous[username] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`DELETE FROM mentions WHERE `+owner+` = $1`, *id)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := parse(content)
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+	users, err := resolve(tx, candidates)
+	if err != nil {
+		return nil, err
+	}
+
+	var added []string
+	seen := make(map[string]bool)
+	for _, c := range candidates {
+		username, ok := users[strings.ToLower(c.name)]
+		if !ok {
+			continue
+		}
+		if !seen[username] {
+			if len(seen) == MaxMentions {
+				continue
+			}
+			seen[username] = true
+			if !previous[username] {
+				added = append(added, username)
+			}
+		}
+		_, err = tx.Exec(`
+			INSERT INTO mentions (post_id, comment_id, username, start_offset, end_offset)
+			VALUES ($1, $2, $3, $4, $5)
+		`, postID, commentID, username, c.start, c.end)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return added, nil
+}
+
+// resolve maps each lowercased candidate name to the matching username
+func resolve(tx *sql.Tx, candidates []candidate) (map[string]string, error) {
+	names := make([]string, len(candidates))
+	for i, c := range candidates {
+		names[i] = strings.ToLower(c.name)
+	}
+
+	rows, err := tx.Query(`
+		SELECT username FROM users
+		WHERE LOWER(username) = ANY(string_to_array($1, ','))
+	`, strings.Join(names, ","))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make(map[string]string)
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			return nil, err
+		}
+		users[strings.ToLower(username)] = username
+	}
+	return users, rows.Err()
+}
+
+// ForPosts returns the mentions in each post, keyed by post ID
+func ForPosts(postIDs []int) (map[int][]models.Mention, error) {
+	return forOwners("post_id", postIDs)
+}
+
+// ForComments returns the mentions in each comment, keyed by comment ID
+func ForComments(commentIDs []int) (map[int][]models.Mention, error) {
+	return forOwners("comment_id", commentIDs)
+}
+
+func forOwners(column string, ownerIDs []int) (map[int][]models.Mention, error) {
+	byOwner := make(map[int][]models.Mention)
+	if len(ownerIDs) == 0 {
+		return byOwner, nil
+	}
+
+	ids := make([]string, len(ownerIDs))
+	for i, id := range ownerIDs {
+		ids[i] = strconv.Itoa(id)
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT `+column+`, username, start_offset, end_offset
+		FROM mentions
+		WHERE `+column+` = ANY(string_to_array($1, ',')::int[])
+		ORDER BY `+column+`, start_offset
+	`, strings.Join(ids, ","))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ownerID int
+		var m models.Mention
+		if err := rows.Scan(&ownerID, &m.Username, &m.Start, &m.End); err != nil {
+			return nil, err
+		}
+		byOwner[ownerID] = append(byOwner[ownerID], m)
+	}
+	return byOwner, rows.Err()
+}
@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/BenH9999/CampusConnect/backend/internal/auth"
+)
+
+// RequireAuth rejects requests without a valid bearer token and stores the
+// token's user in the request context for the handlers
+func RequireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		token, found := strings.CutPrefix(header, "Bearer ")
+		if !found || token == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="campusconnect"`)
+			http.Error(w, "Authorization token required", http.StatusUnauthorized)
+			return
+		}
+		authenticate(w, r, token, next)
+	})
+}
+
+// OptionalAuth lets requests without a token through as signed out, for
+// routes that also serve public content. A token that is sent must still be
+// valid, so clients notice when they need to refresh it.
+func OptionalAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !found || token == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		authenticate(w, r, token, next)
+	})
+}
+
+// authenticate checks an access token and calls next with its user in the
+// request context
+func authenticate(w http.ResponseWriter, r *http.Request, token string, next http.Handler) {
+	claims, err := auth.ParseAccessToken(token)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="campusconnect", error="invalid_token"`)
+		if errors.Is(err, auth.ErrExpiredToken) {
+			http.Error(w, "Token has expired", http.StatusUnauthorized)
+		} else {
+			http.Error(w, "Invalid token", http.StatusUnauthorized)
+		}
+		return
+	}
+
+	// Revoking a session should cut off its access tokens straight away
+	// rather than when they next expire
+	username, active, err := auth.SessionUser(claims.SessionID)
+	if err != nil {
+		http.Error(w, "Failed to verify session", http.StatusInternalServerError)
+		return
+	}
+	if !active {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="campusconnect", error="invalid_token"`)
+		http.Error(w, "Session has been revoked", http.StatusUnauthorized)
+		return
+	}
+
+	ctx := auth.WithUser(r.Context(), username, claims.SessionID)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// RequirePermission is RequireAuth restricted to users whose roles grant perm
+func RequirePermission(perm auth.Permission, next http.Handler) http.Handler {
+	return RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allowed, err := auth.HasPermission(auth.CurrentUser(r), perm)
+		if err != nil {
+			http.Error(w, "Failed to check permissions", http.StatusInternalServerError)
+			return
+		}
+		if !allowed {
+			Forbidden(w)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}))
+}
+
+// Forbidden writes the response used for every action the caller's roles
+// don't allow, so handlers doing their own permission checks reject in the
+// same way as the router
+func Forbidden(w http.ResponseWriter) {
+	http.Error(w, "You don't have permission to do that", http.StatusForbidden)
+}
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+type Affiliation string
+
+const (
+	AffiliationStudent Affiliation = "student"
+	AffiliationStaff   Affiliation = "staff"
+	AffiliationAlumni  Affiliation = "alumni"
+)
+
+// Valid reports whether a is one of the known affiliations
+func (a Affiliation) Valid() bool {
+	switch a {
+	case AffiliationStudent, AffiliationStaff, AffiliationAlumni:
+		return true
+	}
+	return false
+}
+
+type EmailDomain struct {
+	Domain      string      `json:"domain"`
+	Affiliation Affiliation `json:"affiliation"`
+	Source      string      `json:"source"` // "config" or "admin"
+	AddedBy     string      `json:"added_by,omitempty"`
+	CreatedAt   *time.Time  `json:"created_at,omitempty"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+type Attachment struct {
+	ID        int       `json:"id"`
+	URL       string    `json:"url"`
+	MimeType  string    `json:"mime_type"`
+	AltText   string    `json:"alt_text"`
+	Width     int       `json:"width,omitempty"`
+	Height    int       `json:"height,omitempty"`
+	SizeBytes int64     `json:"size_bytes"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+type ExportStatus string
+
+const (
+	ExportPending    ExportStatus = "pending"
+	ExportProcessing ExportStatus = "processing"
+	ExportReady      ExportStatus = "ready"
+	ExportFailed     ExportStatus = "failed"
+)
+
+type DataExport struct {
+	ID          int          `json:"id"`
+	Status      ExportStatus `json:"status"`
+	SizeBytes   int          `json:"size_bytes,omitempty"`
+	CreatedAt   time.Time    `json:"created_at"`
+	CompletedAt *time.Time   `json:"completed_at,omitempty"`
+	ExpiresAt   *time.Time   `json:"expires_at,omitempty"`
+	DownloadURL string       `json:"download_url,omitempty"`
+}
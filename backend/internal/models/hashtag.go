@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+type TrendingTag struct {
+	Tag         string    `json:"tag"`
+	PostCount   int       `json:"post_count"`
+	AuthorCount int       `json:"author_count"`
+	ComputedAt  time.Time `json:"computed_at"`
+}
@@ -0,0 +1,11 @@
+package models
+
+// LinkPreview is the title, description and image a page gives for itself
+// through OpenGraph or Twitter card tags, shown under a link in a post
+type LinkPreview struct {
+	URL         string `json:"url"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	ImageURL    string `json:"image_url"`
+	SiteName    string `json:"site_name"`
+}
@@ -0,0 +1,9 @@
+package models
+
+// Mention marks an @username in a post or comment. Start and End are offsets
+// into the content in UTF-16 code units, covering the @ and the name.
+type Mention struct {
+	Username string `json:"username"`
+	Start    int    `json:"start"`
+	End      int    `json:"end"`
+}
@@ -33,5 +33,5 @@ type ConversationPreview struct {
 type UserBasic struct {
 	Username       string `json:"username"`
 	DisplayName    string `json:"display_name"`
-	ProfilePicture []byte `json:"profile_picture"`
+	ProfilePicture string `json:"profile_picture"` // Avatar URL
 }
@@ -8,8 +8,18 @@ const (
 	TypeLike    NotificationType = "like"
 	TypeComment NotificationType = "comment"
 	TypeFollow  NotificationType = "follow"
+	TypeMention NotificationType = "mention"
+	TypeRepost  NotificationType = "repost"
+	TypeQuote   NotificationType = "quote"
+	// TypePollClosed is sent to a poll's author, from themselves
+	TypePollClosed NotificationType = "poll_closed"
 )
 
+// NotificationSettings are the user's choices about what notifies them
+type NotificationSettings struct {
+	MentionsFromNonFollowers bool `json:"mentions_from_non_followers"`
+}
+
 type Notification struct {
 	ID         int64            `json:"id"`
 	Username   string           `json:"username"`    // Who receives the notification
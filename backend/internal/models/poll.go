@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// Poll is a post's poll as seen by one user. Tallies are shown to everyone,
+// but who voted for what is only ever shown to the voter themselves.
+type Poll struct {
+	MultipleChoice bool         `json:"multiple_choice"`
+	ClosesAt       *time.Time   `json:"closes_at"`
+	Closed         bool         `json:"closed"`
+	Options        []PollOption `json:"options"`
+	// VoterCount is how many people voted, which is fewer than the total of
+	// the option votes when people pick several options
+	VoterCount int `json:"voter_count"`
+	// MyVotes are the IDs of the options the caller voted for
+	MyVotes []int `json:"my_votes"`
+}
+
+type PollOption struct {
+	ID    int    `json:"id"`
+	Text  string `json:"text"`
+	Votes int    `json:"votes"`
+}
@@ -7,4 +7,14 @@ type Post struct {
     Username string `json:"username"`
     Content string `json:"content"`
     CreatedAt time.Time `json:"created_at"`
+    EditedAt *time.Time `json:"edited_at"`
+}
+
+// PostRevision is a post's content as it was before an edit
+type PostRevision struct {
+    ID int `json:"id"`
+    PostID int `json:"post_id"`
+    Content string `json:"content"`
+    CreatedAt time.Time `json:"created_at"` // When this version was written
+    ReplacedAt time.Time `json:"replaced_at"`
 }
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+type Role string
+
+const (
+	RoleAdmin     Role = "admin"
+	RoleModerator Role = "moderator"
+	RoleStaff     Role = "staff"
+	RoleStudent   Role = "student"
+)
+
+// Valid reports whether r is one of the known roles
+func (r Role) Valid() bool {
+	switch r {
+	case RoleAdmin, RoleModerator, RoleStaff, RoleStudent:
+		return true
+	}
+	return false
+}
+
+type RoleGrant struct {
+	Username  string     `json:"username"`
+	Role      Role       `json:"role"`
+	Source    string     `json:"source"` // "config" or "admin"
+	GrantedBy string     `json:"granted_by,omitempty"`
+	GrantedAt *time.Time `json:"granted_at,omitempty"`
+}
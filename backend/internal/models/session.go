@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+type Session struct {
+	ID         int64     `json:"id"`
+	Username   string    `json:"username"`
+	DeviceName string    `json:"device_name"`
+	IPAddress  string    `json:"ip_address"`
+	UserAgent  string    `json:"user_agent"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
@@ -8,6 +8,11 @@ type User struct {
     Password string `json:"password"`
     DisplayName string `json:"display_name"`
     ProfilePicture []byte `json:"profile_picture"`
+    AvatarVersion string `json:"avatar_version"`
     CreatedAt time.Time `json:"created_at"`
     UpdatedAt time.Time `json:"updated_at"`
+    EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+    Affiliation Affiliation `json:"affiliation"`
+    TOTPEnabledAt *time.Time `json:"totp_enabled_at,omitempty"`
+    DeletionScheduledFor *time.Time `json:"deletion_scheduled_for,omitempty"`
 }
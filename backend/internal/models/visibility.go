@@ -0,0 +1,24 @@
+package models
+
+// Visibility controls who can see a post. Authors can always see their own.
+type Visibility string
+
+const (
+	// VisibilityPublic posts can be seen by anyone, even without signing in
+	VisibilityPublic Visibility = "public"
+	// VisibilityCampus posts can be seen by signed-in students and staff
+	VisibilityCampus Visibility = "campus"
+	// VisibilityFollowers posts can be seen by the author's followers
+	VisibilityFollowers Visibility = "followers"
+	// VisibilityPrivate posts can only be seen by the author
+	VisibilityPrivate Visibility = "private"
+)
+
+// Valid reports whether v is one of the known visibility levels
+func (v Visibility) Valid() bool {
+	switch v {
+	case VisibilityPublic, VisibilityCampus, VisibilityFollowers, VisibilityPrivate:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,155 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// keySet is a cached copy of the provider's signing keys
+type keySet struct {
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+// minRefetchInterval stops a stream of tokens with unknown key IDs from
+// hammering the provider's JWKS endpoint
+const minRefetchInterval = time.Minute
+
+// verifySignature checks an RS256 signed JWT against the provider's keys and
+// returns the decoded payload
+func (p *Provider) verifySignature(ctx context.Context, rawToken string) ([]byte, error) {
+	parts := strings.Split(rawToken, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed id_token")
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errors.New("malformed id_token header")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, errors.New("malformed id_token header")
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("unsupported id_token algorithm %q", header.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed id_token signature")
+	}
+
+	key, err := p.signingKey(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, errors.New("invalid id_token signature")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errors.New("malformed id_token payload")
+	}
+	return payload, nil
+}
+
+// signingKey returns the key with the given ID, refetching the key set once
+// if it isn't known, since providers rotate keys
+func (p *Provider) signingKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	cached := p.keys
+	p.mu.Unlock()
+
+	if cached != nil {
+		if key := cached.lookup(kid); key != nil {
+			return key, nil
+		}
+		if time.Since(cached.fetchedAt) < minRefetchInterval {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+	}
+
+	md, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	fresh, err := p.fetchKeys(ctx, md.JWKSURI)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	p.keys = fresh
+	p.mu.Unlock()
+
+	if key := fresh.lookup(kid); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func (p *Provider) fetchKeys(ctx context.Context, jwksURI string) (*keySet, error) {
+	var doc struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := p.getJSON(ctx, jwksURI, &doc); err != nil {
+		return nil, fmt.Errorf("fetching signing keys failed: %w", err)
+	}
+
+	set := &keySet{keys: map[string]*rsa.PublicKey{}, fetchedAt: time.Now()}
+	for _, k := range doc.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			continue
+		}
+		set.keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	return set, nil
+}
+
+// lookup finds a key by ID. Tokens without a kid are accepted if the
+// provider only publishes one key.
+func (s *keySet) lookup(kid string) *rsa.PublicKey {
+	if key, ok := s.keys[kid]; ok {
+		return key
+	}
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key
+		}
+	}
+	return nil
+}
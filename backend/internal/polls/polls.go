@@ -0,0 +1,306 @@
+// Package polls stores the polls attached to posts and their votes
+package polls
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BenH9999/CampusConnect/backend/internal/db"
+	"github.com/BenH9999/CampusConnect/backend/internal/models"
+	"github.com/BenH9999/CampusConnect/backend/internal/utils"
+)
+
+const (
+	MinOptions      = 2
+	MaxOptions      = 10
+	MaxOptionLength = 100
+)
+
+var (
+	ErrOptionCount     = errors.New("wrong number of poll options")
+	ErrOptionText      = errors.New("poll option is empty or too long")
+	ErrDuplicateOption = errors.New("poll options must be different")
+	ErrClosesTooSoon   = errors.New("poll would close before it is published")
+	ErrNotFound        = errors.New("poll not found")
+	ErrClosed          = errors.New("poll is closed")
+	ErrAlreadyVoted    = errors.New("already voted in this poll")
+	ErrNotVoted        = errors.New("not voted in this poll")
+	ErrInvalidChoice   = errors.New("invalid choice of poll options")
+)
+
+// Input is a poll as sent when creating a post
+type Input struct {
+	Options        []string `json:"options"`
+	MultipleChoice bool     `json:"multiple_choice"`
+	// ClosesAt is optional; polls without it stay open
+	ClosesAt *time.Time `json:"closes_at"`
+}
+
+// Validate checks a new poll for a post that goes out at publishAt. Option
+// text is trimmed in place.
+func (in *Input) Validate(publishAt time.Time) error {
+	if len(in.Options) < MinOptions || len(in.Options) > MaxOptions {
+		return ErrOptionCount
+	}
+	seen := make(map[string]bool)
+	for i, option := range in.Options {
+		option = strings.TrimSpace(option)
+		if option == "" || len([]rune(option)) > MaxOptionLength {
+			return ErrOptionText
+		}
+		if seen[strings.ToLower(option)] {
+			return ErrDuplicateOption
+		}
+		seen[strings.ToLower(option)] = true
+		in.Options[i] = option
+	}
+	if in.ClosesAt != nil && !in.ClosesAt.After(publishAt) {
+		return ErrClosesTooSoon
+	}
+	return nil
+}
+
+// Create adds a validated poll to a new post
+func Create(tx *sql.Tx, postID int, in Input) error {
+	_, err := tx.Exec(`
+		INSERT INTO polls (post_id, multiple_choice, closes_at) VALUES ($1, $2, $3)
+	`, postID, in.MultipleChoice, in.ClosesAt)
+	if err != nil {
+		return err
+	}
+	for i, option := range in.Options {
+		_, err := tx.Exec(`
+			INSERT INTO poll_options (post_id, position, text) VALUES ($1, $2, $3)
+		`, postID, i, option)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ForPosts returns the polls on the given posts as viewer sees them, keyed by
+// post ID. Posts without a poll are left out.
+func ForPosts(postIDs []int, viewer string) (map[int]*models.Poll, error) {
+	byPost := make(map[int]*models.Poll)
+	if len(postIDs) == 0 {
+		return byPost, nil
+	}
+
+	ids := make([]string, len(postIDs))
+	for i, id := range postIDs {
+		ids[i] = strconv.Itoa(id)
+	}
+	idList := strings.Join(ids, ",")
+
+	rows, err := db.DB.Query(`
+		SELECT post_id, multiple_choice, closes_at, COALESCE(closes_at <= NOW(), FALSE),
+			(SELECT COUNT(DISTINCT v.username) FROM poll_votes v WHERE v.post_id = pl.post_id)
+		FROM polls pl
+		WHERE post_id = ANY(string_to_array($1, ',')::int[])
+	`, idList)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var postID int
+		poll := &models.Poll{Options: []models.PollOption{}, MyVotes: []int{}}
+		if err := rows.Scan(&postID, &poll.MultipleChoice, &poll.ClosesAt, &poll.Closed, &poll.VoterCount); err != nil {
+			return nil, err
+		}
+		byPost[postID] = poll
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(byPost) == 0 {
+		return byPost, nil
+	}
+
+	rows, err = db.DB.Query(`
+		SELECT o.post_id, o.id, o.text,
+			(SELECT COUNT(*) FROM poll_votes v WHERE v.option_id = o.id)
+		FROM poll_options o
+		WHERE o.post_id = ANY(string_to_array($1, ',')::int[])
+		ORDER BY o.post_id, o.position
+	`, idList)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var postID int
+		var option models.PollOption
+		if err := rows.Scan(&postID, &option.ID, &option.Text, &option.Votes); err != nil {
+			return nil, err
+		}
+		if poll := byPost[postID]; poll != nil {
+			poll.Options = append(poll.Options, option)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if viewer == "" {
+		return byPost, nil
+	}
+	rows, err = db.DB.Query(`
+		SELECT post_id, option_id FROM poll_votes
+		WHERE post_id = ANY(string_to_array($1, ',')::int[]) AND username = $2
+		ORDER BY post_id, option_id
+	`, idList, viewer)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var postID, optionID int
+		if err := rows.Scan(&postID, &optionID); err != nil {
+			return nil, err
+		}
+		if poll := byPost[postID]; poll != nil {
+			poll.MyVotes = append(poll.MyVotes, optionID)
+		}
+	}
+	return byPost, rows.Err()
+}
+
+// Vote records username's vote in the poll on a post. Each person votes
+// once, choosing one option or, in multiple choice polls, several; to change
+// their mind they retract the vote and vote again.
+func Vote(postID int, username string, optionIDs []int) error {
+	chosen := make(map[int]bool)
+	for _, id := range optionIDs {
+		chosen[id] = true
+	}
+	if len(chosen) == 0 {
+		return ErrInvalidChoice
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Locking the poll stops two requests from the same person both voting
+	var multipleChoice, closed bool
+	err = tx.QueryRow(`
+		SELECT pl.multiple_choice, COALESCE(pl.closes_at <= NOW(), FALSE)
+		FROM polls pl
+		JOIN posts p ON p.id = pl.post_id
+		WHERE pl.post_id = $1 AND p.published
+		FOR UPDATE OF pl
+	`, postID).Scan(&multipleChoice, &closed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if closed {
+		return ErrClosed
+	}
+	if len(chosen) > 1 && !multipleChoice {
+		return ErrInvalidChoice
+	}
+
+	var voted bool
+	err = tx.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM poll_votes WHERE post_id = $1 AND username = $2)
+	`, postID, username).Scan(&voted)
+	if err != nil {
+		return err
+	}
+	if voted {
+		return ErrAlreadyVoted
+	}
+
+	ids := make([]string, 0, len(chosen))
+	for id := range chosen {
+		ids = append(ids, strconv.Itoa(id))
+	}
+	res, err := tx.Exec(`
+		INSERT INTO poll_votes (post_id, option_id, username)
+		SELECT post_id, id, $3 FROM poll_options
+		WHERE post_id = $1 AND id = ANY(string_to_array($2, ',')::int[])
+	`, postID, strings.Join(ids, ","), username)
+	if err != nil {
+		return err
+	}
+	// Options from another poll, or that don't exist, aren't inserted
+	if n, err := res.RowsAffected(); err != nil || n != int64(len(ids)) {
+		return ErrInvalidChoice
+	}
+
+	return tx.Commit()
+}
+
+// Retract removes username's vote from the poll on a post while it is open
+func Retract(postID int, username string) error {
+	var closed bool
+	err := db.DB.QueryRow(`
+		SELECT COALESCE(closes_at <= NOW(), FALSE) FROM polls WHERE post_id = $1
+	`, postID).Scan(&closed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if closed {
+		return ErrClosed
+	}
+
+	res, err := db.DB.Exec(`DELETE FROM poll_votes WHERE post_id = $1 AND username = $2`, postID, username)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotVoted
+	}
+	return nil
+}
+
+// NotifyClosed tells the authors of polls that have closed since the last
+// run. Each poll is only reported once.
+func NotifyClosed() error {
+	rows, err := db.DB.Query(`
+		UPDATE polls pl SET close_notified = TRUE
+		FROM posts p
+		WHERE p.id = pl.post_id AND p.published
+			AND pl.closes_at <= NOW() AND NOT pl.close_notified
+		RETURNING pl.post_id, p.username,
+			(SELECT COUNT(DISTINCT v.username) FROM poll_votes v WHERE v.post_id = pl.post_id)
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	type closedPoll struct {
+		postID, voters int
+		author         string
+	}
+	var closed []closedPoll
+	for rows.Next() {
+		var c closedPoll
+		if err := rows.Scan(&c.postID, &c.author, &c.voters); err != nil {
+			return err
+		}
+		closed = append(closed, c)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, c := range closed {
+		utils.CreatePollClosedNotification(c.postID, c.author, c.voters)
+	}
+	return nil
+}
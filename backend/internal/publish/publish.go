@@ -0,0 +1,118 @@
+// Package publish sends drafts and scheduled posts out
+package publish
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+
+	"github.com/BenH9999/CampusConnect/backend/internal/db"
+	"github.com/BenH9999/CampusConnect/backend/internal/utils"
+)
+
+// dueBatchSize caps how many scheduled posts one run of Due publishes
+const dueBatchSize = 100
+
+// ErrAlreadyPublished is returned when the post has already gone out, for
+// example because the scheduler got to it first
+var ErrAlreadyPublished = errors.New("post is already published")
+
+// Post publishes an unpublished post now. Its created_at becomes the publish
+// time, and the people it mentions or quotes are notified as if it had just
+// been written. A poll whose closing time has already passed by then is left
+// open instead, since nobody could have voted in it.
+func Post(postID int) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var author string
+	var quotedPostID *int
+	err = tx.QueryRow(`
+		UPDATE posts SET published = TRUE, publish_at = NULL, created_at = NOW()
+		WHERE id = $1 AND NOT published
+		RETURNING username, quoted_post_id
+	`, postID).Scan(&author, &quotedPostID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrAlreadyPublished
+	}
+	if err != nil {
+		return err
+	}
+
+	// Keep tag timelines and trending in step with the new created_at
+	_, err = tx.Exec(`UPDATE post_hashtags SET created_at = NOW() WHERE post_id = $1`, postID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE polls SET closes_at = NULL WHERE post_id = $1 AND closes_at <= NOW()`, postID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(`SELECT DISTINCT username FROM mentions WHERE post_id = $1`, postID)
+	if err != nil {
+		return err
+	}
+	var mentioned []string
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			rows.Close()
+			return err
+		}
+		mentioned = append(mentioned, username)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	for _, username := range mentioned {
+		utils.CreateMentionNotification(username, author, postID, nil)
+	}
+	if quotedPostID != nil {
+		utils.CreateQuoteNotification(*quotedPostID, postID, author)
+	}
+	return nil
+}
+
+// Due publishes scheduled posts whose publish_at has passed
+func Due() error {
+	rows, err := db.DB.Query(`
+		SELECT id FROM posts
+		WHERE NOT published AND publish_at <= NOW()
+		ORDER BY publish_at
+		LIMIT $1
+	`, dueBatchSize)
+	if err != nil {
+		return err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := Post(id); err != nil && !errors.Is(err, ErrAlreadyPublished) {
+			log.Printf("Error publishing scheduled post %d: %v", id, err)
+		}
+	}
+	return nil
+}
@@ -4,44 +4,131 @@ import (
 	"fmt"
 	"net/http"
 
+	"github.com/BenH9999/CampusConnect/backend/internal/auth"
 	"github.com/BenH9999/CampusConnect/backend/internal/handlers"
+	"github.com/BenH9999/CampusConnect/backend/internal/middleware"
 )
 
+// authed wraps a handler so it is only reachable with a valid access token
+func authed(h http.HandlerFunc) http.Handler {
+	return middleware.RequireAuth(h)
+}
+
+// optionalAuth wraps a handler that serves signed-out requests too, using the
+// access token if one is sent
+func optionalAuth(h http.HandlerFunc) http.Handler {
+	return middleware.OptionalAuth(h)
+}
+
+// allowed wraps a handler so it is only reachable by users whose roles grant perm
+func allowed(perm auth.Permission, h http.HandlerFunc) http.Handler {
+	return middleware.RequirePermission(perm, h)
+}
+
 func SetupRouter() http.Handler {
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("/api/register", handlers.Register)
 	mux.HandleFunc("/api/login", handlers.Login)
-	mux.HandleFunc("/api/feed", handlers.GetFeed)
-	mux.HandleFunc("/api/profile", handlers.GetUserProfile)
-	mux.HandleFunc("/api/profile/update", handlers.UpdateUserProfile)
-	mux.HandleFunc("/api/follow/status", handlers.GetFollowStatus)
-	mux.HandleFunc("/api/follow/toggle", handlers.ToggleFollow)
-	mux.HandleFunc("/api/search/users", handlers.SearchUsers)
-	mux.HandleFunc("/api/posts/create", handlers.CreatePost)
-	mux.HandleFunc("/api/posts/view", handlers.ViewPost)
-	mux.HandleFunc("/api/posts/like", handlers.ToggleLike)
-	mux.HandleFunc("/api/posts/like/status", handlers.CheckLikeStatus)
-	mux.HandleFunc("/api/comments/create", handlers.CreateComment)
+	mux.HandleFunc("/api/login/2fa", handlers.LoginTwoFactor)
+	mux.HandleFunc("/api/token/refresh", handlers.RefreshToken)
+	mux.HandleFunc("/api/verify-email", handlers.VerifyEmail)
+	mux.HandleFunc("/api/verify-email/resend", handlers.ResendVerification)
+	mux.HandleFunc("/api/password/forgot", handlers.ForgotPassword)
+	mux.HandleFunc("/api/password/reset", handlers.ResetPassword)
+	mux.HandleFunc("/api/oidc/login", handlers.OIDCLogin)
+	mux.HandleFunc("/api/oidc/callback", handlers.OIDCCallback)
+	mux.HandleFunc("/api/oidc/exchange", handlers.OIDCExchange)
+
+	// Avatars are public so image caches and CDNs can hold them
+	mux.HandleFunc("/api/users/{username}/avatar", handlers.GetAvatar)
+
+	// Public posts and their attachments can be read without signing in
+	mux.Handle("/api/posts/view", optionalAuth(handlers.ViewPost))
+	mux.Handle("/api/media", optionalAuth(handlers.GetMedia))
+
+	// Everything below requires an access token
+	mux.Handle("/api/feed", authed(handlers.GetFeed))
+	mux.Handle("/api/profile", authed(handlers.GetUserProfile))
+	mux.Handle("/api/profile/update", authed(handlers.UpdateUserProfile))
+	mux.Handle("/api/follow/status", authed(handlers.GetFollowStatus))
+	mux.Handle("/api/follow/toggle", authed(handlers.ToggleFollow))
+	mux.Handle("/api/search/users", authed(handlers.SearchUsers))
+	mux.Handle("/api/posts/create", authed(handlers.CreatePost))
+	mux.Handle("/api/posts/edit", authed(handlers.EditPost))
+	mux.Handle("/api/posts/delete", authed(handlers.DeletePost))
+	mux.Handle("/api/posts/history", authed(handlers.GetPostHistory))
+	mux.Handle("/api/posts/pin", authed(handlers.PinPost))
+	mux.Handle("/api/posts/unpin", authed(handlers.UnpinPost))
+	mux.Handle("/api/posts/drafts", authed(handlers.GetDrafts))
+	mux.Handle("/api/posts/publish", authed(handlers.PublishPost))
+	mux.Handle("/api/posts/schedule", authed(handlers.SchedulePost))
+	mux.Handle("/api/tags/posts", authed(handlers.GetTagPosts))
+	mux.Handle("/api/tags/trending", authed(handlers.GetTrendingTags))
+	mux.Handle("/api/media/upload", authed(handlers.UploadMedia))
+	mux.Handle("/api/posts/like", authed(handlers.ToggleLike))
+	mux.Handle("/api/posts/like/status", authed(handlers.CheckLikeStatus))
+	mux.Handle("/api/posts/repost", authed(handlers.ToggleRepost))
+	mux.Handle("/api/posts/repost/status", authed(handlers.CheckRepostStatus))
+	mux.Handle("/api/bookmarks", authed(handlers.GetBookmarks))
+	mux.Handle("/api/bookmarks/save", authed(handlers.SaveBookmark))
+	mux.Handle("/api/bookmarks/unsave", authed(handlers.RemoveBookmark))
+	mux.Handle("/api/polls/vote", authed(handlers.VotePoll))
+	mux.Handle("/api/polls/retract", authed(handlers.RetractVote))
+	mux.Handle("/api/comments/create", authed(handlers.CreateComment))
 
 	// Notification endpoints
-	mux.HandleFunc("/api/notifications", handlers.GetNotifications)
-	mux.HandleFunc("/api/notifications/read", handlers.MarkNotificationRead)
-	mux.HandleFunc("/api/notifications/read-all", handlers.MarkAllNotificationsRead)
-	mux.HandleFunc("/api/notifications/unread-count", handlers.GetUnreadCount)
+	mux.Handle("/api/notifications", authed(handlers.GetNotifications))
+	mux.Handle("/api/notifications/read", authed(handlers.MarkNotificationRead))
+	mux.Handle("/api/notifications/read-all", authed(handlers.MarkAllNotificationsRead))
+	mux.Handle("/api/notifications/unread-count", authed(handlers.GetUnreadCount))
+	mux.Handle("/api/notifications/settings", authed(handlers.NotificationSettings))
 
 	// Message endpoints
 	fmt.Println("Setting up message endpoints...")
-	mux.HandleFunc("/api/conversations", handlers.GetConversations)
-	mux.HandleFunc("/api/messages", handlers.GetMessages)
-	mux.HandleFunc("/api/messages/send", handlers.SendMessage)
-	mux.HandleFunc("/api/conversations/create", handlers.CreateConversation)
+	mux.Handle("/api/conversations", authed(handlers.GetConversations))
+	mux.Handle("/api/messages", authed(handlers.GetMessages))
+	mux.Handle("/api/messages/send", authed(handlers.SendMessage))
+	mux.Handle("/api/conversations/create", authed(handlers.CreateConversation))
 
 	// This is the problematic endpoint
 	fmt.Println("Registering /api/messages/unread-count endpoint")
-	mux.HandleFunc("/api/messages/unread-count", handlers.GetUnreadMessagesCount)
+	mux.Handle("/api/messages/unread-count", authed(handlers.GetUnreadMessagesCount))
+
+	mux.Handle("/api/followers", authed(handlers.GetFollowers))
+	mux.Handle("/api/roles", authed(handlers.GetMyRoles))
+
+	// Session management endpoints
+	mux.Handle("/api/sessions", authed(handlers.GetSessions))
+	mux.Handle("/api/sessions/revoke", authed(handlers.RevokeSession))
+	mux.Handle("/api/sessions/revoke-all", authed(handlers.RevokeAllSessions))
+	mux.Handle("/api/password/change", authed(handlers.ChangePassword))
+
+	// Data export and account deletion endpoints
+	mux.Handle("/api/account/export", authed(handlers.GetDataExports))
+	mux.Handle("/api/account/export/request", authed(handlers.RequestDataExport))
+	mux.Handle("/api/account/export/download", authed(handlers.DownloadDataExport))
+	mux.Handle("/api/account/username", authed(handlers.ChangeUsername))
+	mux.Handle("/api/account/deletion", authed(handlers.GetAccountDeletion))
+	mux.Handle("/api/account/delete", authed(handlers.DeleteAccount))
+	mux.Handle("/api/account/delete/cancel", authed(handlers.CancelAccountDeletion))
+
+	// Two-factor authentication endpoints
+	mux.Handle("/api/2fa", authed(handlers.GetTwoFactorStatus))
+	mux.Handle("/api/2fa/enroll", authed(handlers.EnrollTwoFactor))
+	mux.Handle("/api/2fa/confirm", authed(handlers.ConfirmTwoFactor))
+	mux.Handle("/api/2fa/disable", authed(handlers.DisableTwoFactor))
+	mux.Handle("/api/2fa/recovery-codes", authed(handlers.RegenerateRecoveryCodes))
 
-	mux.HandleFunc("/api/followers", handlers.GetFollowers)
+	// Admin endpoints
+	mux.Handle("/api/admin/email-domains", allowed(auth.PermManageEmailDomains, handlers.GetEmailDomains))
+	mux.Handle("/api/admin/email-domains/add", allowed(auth.PermManageEmailDomains, handlers.AddEmailDomain))
+	mux.Handle("/api/admin/email-domains/remove", allowed(auth.PermManageEmailDomains, handlers.RemoveEmailDomain))
+	mux.Handle("/api/admin/lockouts", allowed(auth.PermManageLockouts, handlers.GetLoginLockouts))
+	mux.Handle("/api/admin/lockouts/clear", allowed(auth.PermManageLockouts, handlers.ClearLoginLockout))
+	mux.Handle("/api/admin/roles", allowed(auth.PermManageRoles, handlers.GetRoleGrants))
+	mux.Handle("/api/admin/roles/grant", allowed(auth.PermManageRoles, handlers.GrantRole))
+	mux.Handle("/api/admin/roles/revoke", allowed(auth.PermManageRoles, handlers.RevokeRole))
 
 	fmt.Println("Router setup complete")
 	return mux
@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"log"
+
+	"github.com/BenH9999/CampusConnect/backend/internal/config"
+)
+
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore keeps uploaded files by key. Implementations must be safe for
+// concurrent use.
+type BlobStore interface {
+	Put(key, contentType string, data []byte) error
+	Get(key string) (io.ReadCloser, error)
+	Delete(key string) error
+}
+
+// Default is the store used by the handlers, set up by Init
+var Default BlobStore = NewLocalStore("uploads")
+
+// Init selects the store implementation from the storage config
+func Init() {
+	cfg := config.GetStorageConfig()
+
+	switch cfg.Driver {
+	case "local":
+		Default = NewLocalStore(cfg.LocalPath)
+		log.Println("Storing media on disk in", cfg.LocalPath)
+	case "s3":
+		if cfg.S3Bucket == "" || cfg.S3AccessKeyID == "" || cfg.S3SecretKey == "" {
+			log.Fatal("STORAGE_DRIVER is s3 but S3_BUCKET or the S3 credentials are not set")
+		}
+		Default = NewS3Store(cfg.S3Endpoint, cfg.S3Region, cfg.S3Bucket, cfg.S3AccessKeyID, cfg.S3SecretKey, cfg.S3ForcePathStyle)
+		log.Println("Storing media in S3 bucket", cfg.S3Bucket)
+	default:
+		log.Fatal("Unknown STORAGE_DRIVER: ", cfg.Driver)
+	}
+}
@@ -0,0 +1,191 @@
+package throttle
+
+import (
+	"testing"
+	"time"
+)
+
+var testPolicies = map[string]Policy{
+	KindAccount: {
+		FreeAttempts:     2,
+		BaseDelay:        time.Second,
+		MaxDelay:         8 * time.Second,
+		LockoutThreshold: 8,
+		LockoutDuration:  15 * time.Minute,
+		ResetAfter:       time.Hour,
+	},
+	KindIP: {
+		FreeAttempts:     4,
+		BaseDelay:        time.Second,
+		MaxDelay:         time.Minute,
+		LockoutThreshold: 20,
+		LockoutDuration:  time.Hour,
+		ResetAfter:       time.Hour,
+	},
+}
+
+// clock is a fake time source that only moves when told to
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time          { return c.t }
+func (c *clock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestLimiter() (*Limiter, *clock) {
+	c := &clock{t: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+	l := NewLimiter(NewMemoryStore(), testPolicies)
+	l.now = c.now
+	return l, c
+}
+
+var (
+	account = Key{Kind: KindAccount, Value: "alice@uni.ac.uk"}
+	ip      = Key{Kind: KindIP, Value: "203.0.113.7"}
+)
+
+func fail(t *testing.T, l *Limiter, keys ...Key) {
+	t.Helper()
+	if err := l.Fail(keys...); err != nil {
+		t.Fatalf("Fail: %v", err)
+	}
+}
+
+func wait(t *testing.T, l *Limiter, keys ...Key) time.Duration {
+	t.Helper()
+	d, err := l.Wait(keys...)
+	if err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	return d
+}
+
+func TestBackoffDoublesAfterFreeAttempts(t *testing.T) {
+	l, _ := newTestLimiter()
+
+	// Each failure's delay, capped at MaxDelay until the lockout threshold
+	want := []time.Duration{0, 0, time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 8 * time.Second}
+	for i, expected := range want {
+		fail(t, l, account)
+		if got := wait(t, l, account); got != expected {
+			t.Errorf("after %d failures: wait = %v, want %v", i+1, got, expected)
+		}
+	}
+}
+
+func TestLockoutAfterThreshold(t *testing.T) {
+	l, _ := newTestLimiter()
+
+	for range testPolicies[KindAccount].LockoutThreshold {
+		fail(t, l, account)
+	}
+
+	if got := wait(t, l, account); got != 15*time.Minute {
+		t.Errorf("wait = %v, want the 15m lockout", got)
+	}
+	blocked, err := l.Blocked()
+	if err != nil {
+		t.Fatalf("Blocked: %v", err)
+	}
+	if len(blocked) != 1 || blocked[0].Key != account.String() || !blocked[0].Locked {
+		t.Errorf("Blocked() = %+v, want one locked record for %s", blocked, account)
+	}
+}
+
+func TestLockoutExpires(t *testing.T) {
+	l, c := newTestLimiter()
+
+	for range testPolicies[KindAccount].LockoutThreshold {
+		fail(t, l, account)
+	}
+
+	c.advance(15*time.Minute - time.Second)
+	if got := wait(t, l, account); got != time.Second {
+		t.Errorf("just before expiry: wait = %v, want 1s", got)
+	}
+
+	c.advance(time.Second)
+	if got := wait(t, l, account); got != 0 {
+		t.Errorf("after expiry: wait = %v, want 0", got)
+	}
+	blocked, err := l.Blocked()
+	if err != nil {
+		t.Fatalf("Blocked: %v", err)
+	}
+	if len(blocked) != 0 {
+		t.Errorf("Blocked() = %+v, want none", blocked)
+	}
+}
+
+func TestFailuresResetAfterQuietPeriod(t *testing.T) {
+	l, c := newTestLimiter()
+
+	for range 3 {
+		fail(t, l, account)
+	}
+	c.advance(time.Hour + time.Second)
+
+	// The count starts again, so this is a free attempt
+	fail(t, l, account)
+	if got := wait(t, l, account); got != 0 {
+		t.Errorf("wait = %v, want 0 after the count reset", got)
+	}
+}
+
+func TestResetClearsAccountButNotIP(t *testing.T) {
+	l, _ := newTestLimiter()
+
+	for range 6 {
+		fail(t, l, account, ip)
+	}
+	if got := wait(t, l, account); got == 0 {
+		t.Fatal("account should be delayed before reset")
+	}
+	ipWait := wait(t, l, ip)
+	if ipWait == 0 {
+		t.Fatal("IP should be delayed before reset")
+	}
+
+	// A successful login only clears the account key
+	if err := l.Reset(account.String()); err != nil {
+		t.Fatalf("Reset: %v", err)
+	}
+
+	if got := wait(t, l, account); got != 0 {
+		t.Errorf("account wait = %v, want 0 after reset", got)
+	}
+	if got := wait(t, l, ip); got != ipWait {
+		t.Errorf("IP wait = %v, want it unchanged at %v", got, ipWait)
+	}
+	if got := wait(t, l, account, ip); got != ipWait {
+		t.Errorf("combined wait = %v, want the IP's %v", got, ipWait)
+	}
+}
+
+func TestIPHasItsOwnPolicy(t *testing.T) {
+	l, _ := newTestLimiter()
+
+	// Three accounts failing from one address: each account stays within
+	// its free attempts, but the address goes over its own
+	for _, user := range []string{"a@uni.ac.uk", "b@uni.ac.uk", "c@uni.ac.uk"} {
+		key := Key{Kind: KindAccount, Value: user}
+		for range 2 {
+			fail(t, l, key, ip)
+		}
+		if got := wait(t, l, key); got != 0 {
+			t.Errorf("%s: wait = %v, want 0", user, got)
+		}
+	}
+
+	// Six IP failures against four free attempts: 1s, then 2s
+	if got := wait(t, l, ip); got != 2*time.Second {
+		t.Errorf("IP wait = %v, want 2s", got)
+	}
+
+	for range testPolicies[KindIP].LockoutThreshold - 6 {
+		fail(t, l, ip)
+	}
+	if got := wait(t, l, ip); got != time.Hour {
+		t.Errorf("IP wait = %v, want the 1h IP lockout", got)
+	}
+}
@@ -0,0 +1,78 @@
+package throttle
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps records in process memory, for tests and single instance deployments
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]*Record
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: map[string]*Record{}}
+}
+
+func (s *MemoryStore) Get(key string) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, ok := s.records[key]
+	if !ok {
+		return nil, nil
+	}
+	snapshot := *rec
+	return &snapshot, nil
+}
+
+func (s *MemoryStore) Increment(key string, now time.Time, resetBefore time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, ok := s.records[key]
+	if !ok || rec.LastFailureAt.Before(resetBefore) {
+		rec = &Record{Key: key}
+		s.records[key] = rec
+	}
+	rec.Failures++
+	rec.LastFailureAt = now
+	return rec.Failures, nil
+}
+
+func (s *MemoryStore) Block(key string, until time.Time, locked bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if rec, ok := s.records[key]; ok {
+		rec.BlockedUntil = until
+		rec.Locked = locked
+	}
+	return nil
+}
+
+func (s *MemoryStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, key)
+	return nil
+}
+
+func (s *MemoryStore) ListBlocked(now time.Time) ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	blocked := []Record{}
+	for _, rec := range s.records {
+		if rec.BlockedUntil.After(now) {
+			blocked = append(blocked, *rec)
+		}
+	}
+	sort.Slice(blocked, func(i, j int) bool {
+		return blocked[i].BlockedUntil.After(blocked[j].BlockedUntil)
+	})
+	return blocked, nil
+}
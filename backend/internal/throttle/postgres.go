@@ -0,0 +1,79 @@
+package throttle
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/BenH9999/CampusConnect/backend/internal/db"
+)
+
+// PostgresStore keeps records in the login_attempts table so every server
+// instance sees the same counts
+type PostgresStore struct{}
+
+func NewPostgresStore() *PostgresStore {
+	return &PostgresStore{}
+}
+
+func (s *PostgresStore) Get(key string) (*Record, error) {
+	var rec Record
+	var blockedUntil sql.NullTime
+	err := db.DB.QueryRow(`
+		SELECT key, failures, last_failure_at, blocked_until, locked
+		FROM login_attempts WHERE key = $1
+	`, key).Scan(&rec.Key, &rec.Failures, &rec.LastFailureAt, &blockedUntil, &rec.Locked)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	rec.BlockedUntil = blockedUntil.Time
+	return &rec, nil
+}
+
+func (s *PostgresStore) Increment(key string, now time.Time, resetBefore time.Time) (int, error) {
+	var failures int
+	err := db.DB.QueryRow(`
+		INSERT INTO login_attempts (key, failures, last_failure_at)
+		VALUES ($1, 1, $2)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN login_attempts.last_failure_at < $3 THEN 1 ELSE login_attempts.failures + 1 END,
+			last_failure_at = $2
+		RETURNING failures
+	`, key, now, resetBefore).Scan(&failures)
+	return failures, err
+}
+
+func (s *PostgresStore) Block(key string, until time.Time, locked bool) error {
+	_, err := db.DB.Exec(`UPDATE login_attempts SET blocked_until = $2, locked = $3 WHERE key = $1`, key, until, locked)
+	return err
+}
+
+func (s *PostgresStore) Delete(key string) error {
+	_, err := db.DB.Exec(`DELETE FROM login_attempts WHERE key = $1`, key)
+	return err
+}
+
+func (s *PostgresStore) ListBlocked(now time.Time) ([]Record, error) {
+	rows, err := db.DB.Query(`
+		SELECT key, failures, last_failure_at, blocked_until, locked
+		FROM login_attempts
+		WHERE blocked_until > $1
+		ORDER BY blocked_until DESC
+	`, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	blocked := []Record{}
+	for rows.Next() {
+		var rec Record
+		if err := rows.Scan(&rec.Key, &rec.Failures, &rec.LastFailureAt, &rec.BlockedUntil, &rec.Locked); err != nil {
+			return nil, err
+		}
+		blocked = append(blocked, rec)
+	}
+	return blocked, rows.Err()
+}
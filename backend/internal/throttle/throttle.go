@@ -0,0 +1,178 @@
+package throttle
+
+import (
+	"log"
+	"time"
+
+	"github.com/BenH9999/CampusConnect/backend/internal/config"
+)
+
+// Kinds of key attempts are tracked under, each with its own policy
+const (
+	KindAccount   = "account"
+	KindIP        = "ip"
+	KindTwoFactor = "2fa"
+)
+
+// Policy controls how quickly failures are slowed down and locked out
+type Policy struct {
+	// FreeAttempts failures are allowed before any delay applies
+	FreeAttempts int
+	// BaseDelay is the first delay, doubling with each further failure up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// LockoutThreshold failures lock the key for LockoutDuration
+	LockoutThreshold int
+	LockoutDuration  time.Duration
+	// ResetAfter without a failure clears the count
+	ResetAfter time.Duration
+}
+
+var DefaultPolicies = map[string]Policy{
+	KindAccount: {
+		FreeAttempts:     3,
+		BaseDelay:        time.Second,
+		MaxDelay:         5 * time.Minute,
+		LockoutThreshold: 10,
+		LockoutDuration:  15 * time.Minute,
+		ResetAfter:       time.Hour,
+	},
+	// A 6 digit code is easy to guess given enough tries, so lock out early
+	KindTwoFactor: {
+		FreeAttempts:     3,
+		BaseDelay:        time.Second,
+		MaxDelay:         time.Minute,
+		LockoutThreshold: 6,
+		LockoutDuration:  15 * time.Minute,
+		ResetAfter:       time.Hour,
+	},
+	// An IP may be shared by a whole halls of residence, so it gets more room
+	KindIP: {
+		FreeAttempts:     20,
+		BaseDelay:        time.Second,
+		MaxDelay:         5 * time.Minute,
+		LockoutThreshold: 100,
+		LockoutDuration:  time.Hour,
+		ResetAfter:       time.Hour,
+	},
+}
+
+// Key identifies what an attempt is counted against
+type Key struct {
+	Kind  string
+	Value string
+}
+
+func (k Key) String() string {
+	return k.Kind + ":" + k.Value
+}
+
+// Record is the stored failure state for one key
+type Record struct {
+	Key           string    `json:"key"`
+	Failures      int       `json:"failures"`
+	LastFailureAt time.Time `json:"last_failure_at"`
+	BlockedUntil  time.Time `json:"blocked_until"`
+	Locked        bool      `json:"locked"`
+}
+
+// Store persists failure records. Increment must be atomic.
+type Store interface {
+	Get(key string) (*Record, error)
+	Increment(key string, now time.Time, resetBefore time.Time) (int, error)
+	Block(key string, until time.Time, locked bool) error
+	Delete(key string) error
+	ListBlocked(now time.Time) ([]Record, error)
+}
+
+// Login is the limiter used by the login handler, set up by Init
+var Login = NewLimiter(NewMemoryStore(), DefaultPolicies)
+
+// Init selects where login attempts are stored. The memory store only works
+// with a single server instance.
+func Init() {
+	switch store := config.GetLoginThrottleStore(); store {
+	case "postgres":
+		Login = NewLimiter(NewPostgresStore(), DefaultPolicies)
+	case "memory":
+		Login = NewLimiter(NewMemoryStore(), DefaultPolicies)
+	default:
+		log.Fatal("Unknown LOGIN_THROTTLE_STORE: ", store)
+	}
+}
+
+// Limiter applies backoff and lockout policies on top of a store
+type Limiter struct {
+	store    Store
+	policies map[string]Policy
+	now      func() time.Time
+}
+
+func NewLimiter(store Store, policies map[string]Policy) *Limiter {
+	return &Limiter{store: store, policies: policies, now: time.Now}
+}
+
+// Wait returns how long the caller must wait before another attempt against
+// any of the keys is allowed, or 0 if it may go ahead
+func (l *Limiter) Wait(keys ...Key) (time.Duration, error) {
+	now := l.now()
+	var wait time.Duration
+	for _, key := range keys {
+		rec, err := l.store.Get(key.String())
+		if err != nil {
+			return 0, err
+		}
+		if rec != nil && rec.BlockedUntil.After(now) {
+			wait = max(wait, rec.BlockedUntil.Sub(now))
+		}
+	}
+	return wait, nil
+}
+
+// Fail records a failed attempt against each key and blocks any that have
+// gone over their policy
+func (l *Limiter) Fail(keys ...Key) error {
+	now := l.now()
+	for _, key := range keys {
+		policy := l.policies[key.Kind]
+
+		failures, err := l.store.Increment(key.String(), now, now.Add(-policy.ResetAfter))
+		if err != nil {
+			return err
+		}
+
+		if delay, locked := policy.delay(failures); delay > 0 {
+			if err := l.store.Block(key.String(), now.Add(delay), locked); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Reset clears the failures for a key, after a successful login or by an admin
+func (l *Limiter) Reset(key string) error {
+	return l.store.Delete(key)
+}
+
+// Blocked lists every key that is currently delayed or locked out
+func (l *Limiter) Blocked() ([]Record, error) {
+	return l.store.ListBlocked(l.now())
+}
+
+// delay returns how long to block after the given number of failures and
+// whether that counts as a lockout
+func (p Policy) delay(failures int) (time.Duration, bool) {
+	if p.LockoutThreshold > 0 && failures >= p.LockoutThreshold {
+		return p.LockoutDuration, true
+	}
+	if failures <= p.FreeAttempts {
+		return 0, false
+	}
+
+	shift := failures - p.FreeAttempts - 1
+	if shift > 30 {
+		return p.MaxDelay, false
+	}
+	return min(p.BaseDelay<<shift, p.MaxDelay), false
+}
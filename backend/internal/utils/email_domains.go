@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"database/sql"
+	"slices"
+	"strings"
+
+	"github.com/BenH9999/CampusConnect/backend/internal/config"
+	"github.com/BenH9999/CampusConnect/backend/internal/db"
+	"github.com/BenH9999/CampusConnect/backend/internal/models"
+)
+
+// EmailDomain returns the lower case domain part of an email address
+func EmailDomain(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return ""
+	}
+	return strings.ToLower(email[at+1:])
+}
+
+// ResolveAffiliation checks the email's domain against the configured and
+// admin-added domain allowlists and returns the affiliation it grants. If
+// neither list has any entries every domain is allowed.
+func ResolveAffiliation(email string) (models.Affiliation, bool, error) {
+	domain := EmailDomain(email)
+	if domain == "" {
+		return "", false, nil
+	}
+
+	// Admin-added domains take priority so they can override the config mapping
+	var affiliation string
+	err := db.DB.QueryRow(`SELECT affiliation FROM allowed_email_domains WHERE domain = $1`, domain).Scan(&affiliation)
+	if err == nil {
+		return models.Affiliation(affiliation), true, nil
+	}
+	if err != sql.ErrNoRows {
+		return "", false, err
+	}
+
+	configured := config.GetAllowedEmailDomains()
+	if !slices.Contains(configured, domain) {
+		if len(configured) > 0 {
+			return "", false, nil
+		}
+
+		var adminDomains int
+		if err := db.DB.QueryRow(`SELECT COUNT(*) FROM allowed_email_domains`).Scan(&adminDomains); err != nil {
+			return "", false, err
+		}
+		if adminDomains > 0 {
+			return "", false, nil
+		}
+	}
+
+	return configuredAffiliation(domain), true, nil
+}
+
+// ListEmailDomains returns the configured domains followed by the admin-added ones
+func ListEmailDomains() ([]models.EmailDomain, error) {
+	domains := []models.EmailDomain{}
+	for _, domain := range config.GetAllowedEmailDomains() {
+		domains = append(domains, models.EmailDomain{
+			Domain:      domain,
+			Affiliation: configuredAffiliation(domain),
+			Source:      "config",
+		})
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT domain, affiliation, added_by, created_at
+		FROM allowed_email_domains
+		ORDER BY domain
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		d := models.EmailDomain{Source: "admin"}
+		var addedBy sql.NullString
+		if err := rows.Scan(&d.Domain, &d.Affiliation, &addedBy, &d.CreatedAt); err != nil {
+			return nil, err
+		}
+		d.AddedBy = addedBy.String
+		domains = append(domains, d)
+	}
+	return domains, rows.Err()
+}
+
+func configuredAffiliation(domain string) models.Affiliation {
+	if affiliation, ok := config.GetEmailDomainAffiliations()[domain]; ok {
+		return models.Affiliation(affiliation)
+	}
+	return models.Affiliation(config.GetDefaultAffiliation())
+}
@@ -2,9 +2,11 @@ package utils
 
 import (
 	"log"
+	"strconv"
 
 	"github.com/BenH9999/CampusConnect/backend/internal/db"
 	"github.com/BenH9999/CampusConnect/backend/internal/models"
+	"github.com/BenH9999/CampusConnect/backend/internal/visibility"
 )
 
 // CreateNotification generates a notification in the database
@@ -72,6 +74,129 @@ func CreateCommentNotification(postID int, commentedByUsername string) {
 	CreateNotification(postOwner, commentedByUsername, string(models.TypeComment), &postID, nil, message)
 }
 
+// CreateRepostNotification creates a notification for a repost event. Undoing
+// and redoing a repost doesn't notify the author again.
+func CreateRepostNotification(postID int, repostedByUsername string) {
+	var postOwner string
+	err := db.DB.QueryRow("SELECT username FROM posts WHERE id = $1", postID).Scan(&postOwner)
+	if err != nil {
+		log.Printf("Error finding post owner for notification: %v", err)
+		return
+	}
+
+	// Don't notify if user reposts their own post
+	if postOwner == repostedByUsername {
+		return
+	}
+
+	var notified bool
+	err = db.DB.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM notifications WHERE type = $1 AND post_id = $2 AND sender_name = $3)
+	`, string(models.TypeRepost), postID, repostedByUsername).Scan(&notified)
+	if err != nil {
+		log.Printf("Error checking for repost notification: %v", err)
+		return
+	}
+	if notified {
+		return
+	}
+
+	var displayName string
+	err = db.DB.QueryRow("SELECT display_name FROM users WHERE username = $1", repostedByUsername).Scan(&displayName)
+	if err != nil {
+		displayName = repostedByUsername
+	}
+
+	message := displayName + " reposted your post"
+	CreateNotification(postOwner, repostedByUsername, string(models.TypeRepost), &postID, nil, message)
+}
+
+// CreateQuoteNotification creates a notification for a quote post. It points
+// at the new quote post rather than the one quoted.
+func CreateQuoteNotification(quotedPostID, quotePostID int, quotedByUsername string) {
+	var postOwner string
+	err := db.DB.QueryRow("SELECT username FROM posts WHERE id = $1", quotedPostID).Scan(&postOwner)
+	if err != nil {
+		log.Printf("Error finding post owner for notification: %v", err)
+		return
+	}
+
+	if postOwner == quotedByUsername {
+		return
+	}
+	if visible, err := visibility.CanView(postOwner, quotePostID); err != nil || !visible {
+		return
+	}
+
+	var displayName string
+	err = db.DB.QueryRow("SELECT display_name FROM users WHERE username = $1", quotedByUsername).Scan(&displayName)
+	if err != nil {
+		displayName = quotedByUsername
+	}
+
+	message := displayName + " quoted your post"
+	CreateNotification(postOwner, quotedByUsername, string(models.TypeQuote), &quotePostID, nil, message)
+}
+
+// CreatePollClosedNotification tells a poll's author that it has closed
+func CreatePollClosedNotification(postID int, author string, voters int) {
+	message := "Your poll has closed with " + strconv.Itoa(voters) + " votes"
+	if voters == 1 {
+		message = "Your poll has closed with 1 vote"
+	}
+	CreateNotification(author, author, string(models.TypePollClosed), &postID, nil, message)
+}
+
+// CreateMentionNotification creates a notification for being mentioned in a
+// post, or in a comment if commentID is set. People who turned off mentions
+// from non-followers only hear from those who follow them.
+func CreateMentionNotification(mentionedUsername, mentionedByUsername string, postID int, commentID *int) {
+	if mentionedUsername == mentionedByUsername {
+		return
+	}
+
+	// Being mentioned in a post the user can't see shouldn't reveal it
+	if visible, err := visibility.CanView(mentionedUsername, postID); err != nil || !visible {
+		return
+	}
+
+	// The post's author already hears about comments on it
+	if commentID != nil {
+		var postOwner string
+		err := db.DB.QueryRow("SELECT username FROM posts WHERE id = $1", postID).Scan(&postOwner)
+		if err != nil || postOwner == mentionedUsername {
+			return
+		}
+	}
+
+	var notify bool
+	err := db.DB.QueryRow(`
+		SELECT u.notify_mentions_from_non_followers
+			OR EXISTS(SELECT 1 FROM follows WHERE follower = $2 AND following = u.username)
+		FROM users u WHERE u.username = $1
+	`, mentionedUsername, mentionedByUsername).Scan(&notify)
+	if err != nil {
+		log.Printf("Error checking mention settings for notification: %v", err)
+		return
+	}
+	if !notify {
+		return
+	}
+
+	// Get the display name for a more friendly message
+	var displayName string
+	err = db.DB.QueryRow("SELECT display_name FROM users WHERE username = $1", mentionedByUsername).Scan(&displayName)
+	if err != nil {
+		displayName = mentionedByUsername
+	}
+
+	message := displayName + " mentioned you in a post"
+	if commentID != nil {
+		message = displayName + " mentioned you in a comment"
+	}
+	CreateNotification(mentionedUsername, mentionedByUsername, string(models.TypeMention), &postID, commentID, message)
+}
+
 // CreateFollowNotification creates a notification for a follow event
 func CreateFollowNotification(followedUsername, followerUsername string) {
 	// Get the display name for a more friendly message
@@ -0,0 +1,143 @@
+package validation
+
+import (
+	"net/mail"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	UsernameMinLength    = 3
+	UsernameMaxLength    = 30
+	EmailMaxLength       = 100
+	PasswordMinLength    = 8
+	PasswordMaxLength    = 72 // bcrypt ignores anything past 72 bytes
+	DisplayNameMaxLength = 50
+)
+
+// Error codes returned to clients alongside the human readable message
+const (
+	CodeRequired      = "required"
+	CodeTooShort      = "too_short"
+	CodeTooLong       = "too_long"
+	CodeInvalidFormat = "invalid_format"
+	CodeTooWeak       = "too_weak"
+	CodeTaken         = "taken"
+	CodeTooLarge      = "too_large"
+)
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_]+(\.[A-Za-z0-9_]+)*$`)
+
+// FieldError describes a problem with one input field
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Errors collects field errors while validating a request
+type Errors []FieldError
+
+// Add records an error for a field
+func (e *Errors) Add(field, code, message string) {
+	*e = append(*e, FieldError{Field: field, Code: code, Message: message})
+}
+
+// Any reports whether any errors were recorded
+func (e Errors) Any() bool {
+	return len(e) > 0
+}
+
+// Username checks a username is 3-30 letters, digits, underscores or
+// non-consecutive dots, with no dot at either end
+func (e *Errors) Username(field, username string) {
+	switch n := len(username); {
+	case n == 0:
+		e.Add(field, CodeRequired, "Username is required")
+	case n < UsernameMinLength:
+		e.Add(field, CodeTooShort, "Username must be at least 3 characters")
+	case n > UsernameMaxLength:
+		e.Add(field, CodeTooLong, "Username must be at most 30 characters")
+	case !usernamePattern.MatchString(username):
+		e.Add(field, CodeInvalidFormat, "Username can only contain letters, numbers, underscores and dots")
+	}
+}
+
+// Email checks for a single bare address such as name@uni.ac.uk
+func (e *Errors) Email(field, email string) {
+	if email == "" {
+		e.Add(field, CodeRequired, "Email is required")
+		return
+	}
+	if len(email) > EmailMaxLength {
+		e.Add(field, CodeTooLong, "Email must be at most 100 characters")
+		return
+	}
+
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email || addr.Name != "" {
+		e.Add(field, CodeInvalidFormat, "Email address is not valid")
+		return
+	}
+
+	_, domain, _ := strings.Cut(email, "@")
+	if !strings.Contains(domain, ".") || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") {
+		e.Add(field, CodeInvalidFormat, "Email address is not valid")
+	}
+}
+
+// Password checks length and that the password mixes letters and numbers
+// and isn't built from the username
+func (e *Errors) Password(field, password, username string) {
+	switch {
+	case password == "":
+		e.Add(field, CodeRequired, "Password is required")
+		return
+	case utf8.RuneCountInString(password) < PasswordMinLength:
+		e.Add(field, CodeTooShort, "Password must be at least 8 characters")
+		return
+	case len(password) > PasswordMaxLength:
+		e.Add(field, CodeTooLong, "Password must be at most 72 bytes")
+		return
+	}
+
+	var hasLetter, hasDigit bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLetter(r):
+			hasLetter = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		}
+	}
+	if !hasLetter || !hasDigit {
+		e.Add(field, CodeTooWeak, "Password must contain both letters and numbers")
+		return
+	}
+
+	if username != "" && strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		e.Add(field, CodeTooWeak, "Password must not contain your username")
+	}
+}
+
+// DisplayName checks a display name is 1-50 characters with no control characters
+func (e *Errors) DisplayName(field, displayName string) {
+	trimmed := strings.TrimSpace(displayName)
+	switch {
+	case trimmed == "":
+		e.Add(field, CodeRequired, "Display name is required")
+		return
+	case utf8.RuneCountInString(displayName) > DisplayNameMaxLength:
+		e.Add(field, CodeTooLong, "Display name must be at most 50 characters")
+		return
+	}
+
+	for _, r := range displayName {
+		if unicode.IsControl(r) {
+			e.Add(field, CodeInvalidFormat, "Display name contains invalid characters")
+			return
+		}
+	}
+}
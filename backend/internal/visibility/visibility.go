@@ -0,0 +1,38 @@
+// Package visibility decides which posts a viewer is allowed to see
+package visibility
+
+import (
+	"fmt"
+
+	"github.com/BenH9999/CampusConnect/backend/internal/db"
+)
+
+// Clause returns an SQL condition that holds when the viewer can see the
+// post aliased as post. viewer is the placeholder holding the viewer's
+// username, which is empty for signed-out requests. Hidden posts should be
+// treated exactly like missing ones, so their existence isn't revealed.
+//
+// Authors can see their own drafts and scheduled posts through this, so
+// lists of posts must also check published to keep them out.
+func Clause(post, viewer string) string {
+	return fmt.Sprintf(`(
+		%[1]s.username = %[2]s
+		OR (%[1]s.published AND (
+			%[1]s.visibility = 'public'
+			OR (%[1]s.visibility = 'campus' AND EXISTS(
+				SELECT 1 FROM users viewer WHERE viewer.username = %[2]s AND viewer.affiliation IN ('student', 'staff')))
+			OR (%[1]s.visibility = 'followers' AND EXISTS(
+				SELECT 1 FROM follows viewer_follows WHERE viewer_follows.follower = %[2]s AND viewer_follows.following = %[1]s.username))
+		))
+	)`, post, viewer)
+}
+
+// CanView reports whether viewer can see a post. It is false for posts that
+// don't exist.
+func CanView(viewer string, postID int) (bool, error) {
+	var visible bool
+	err := db.DB.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM posts p WHERE p.id = $1 AND `+Clause("p", "$2")+`)
+	`, postID, viewer).Scan(&visible)
+	return visible, err
+}
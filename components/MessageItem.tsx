@@ -73,7 +73,7 @@ const MessageItem: React.FC<MessageItemProps> = ({
       <View style={styles.avatarContainer}>
         {participant.profile_picture ? (
           <Image
-            source={{ uri: `data:image/jpeg;base64,${participant.profile_picture}` }}
+            source={{ uri: participant.profile_picture }}
             style={styles.avatar}
           />
         ) : (
@@ -77,13 +77,8 @@ export default function NotificationItem({
   const getProfilePictureUri = () => {
     if (!sender_profile_picture) return null;
     
-    // Check if the URI already has the data prefix
-    if (sender_profile_picture.startsWith('data:')) {
-      return sender_profile_picture;
-    }
-    
-    // Add the data URI prefix if it's missing
-    return `data:image/png;base64,${sender_profile_picture}`;
+    // The API returns an avatar URL
+    return sender_profile_picture;
   };
 
   const profilePictureUri = getProfilePictureUri();
@@ -5,7 +5,6 @@ import { useRouter } from "expo-router";
 import ProfileButton from "@/components/ProfileButton";
 import FontAwesome from "@expo/vector-icons/FontAwesome";
 import { useAuth } from "@/context/AuthContext";
-import { BASE_URL } from "@/constants/api";
 
 export type PostProps = {
   id: number;
@@ -32,7 +31,7 @@ const Post: React.FC<PostProps> = ({
   onLikeUpdate,
 }) => {
   const router = useRouter();
-  const { user } = useAuth();
+  const { user, authFetch } = useAuth();
   const [likeCount, setLikeCount] = useState(likes_count);
   const [isLiked, setIsLiked] = useState(initialIsLiked || false);
   const [likeLoading, setLikeLoading] = useState(false);
@@ -43,7 +42,7 @@ const Post: React.FC<PostProps> = ({
       if (!user) return;
       
       try {
-        const response = await fetch(`${BASE_URL}/api/posts/like/status?post_id=${id}&username=${user.username}`);
+        const response = await authFetch(`/api/posts/like/status?post_id=${id}`);
         if (response.ok) {
           const data = await response.json();
           setIsLiked(data.is_liked);
@@ -54,7 +53,7 @@ const Post: React.FC<PostProps> = ({
     };
     
     checkLikeStatus();
-  }, [id, user]);
+  }, [id, user, authFetch]);
 
   const handlePostPress = () => {
     router.push(`/post/${id}`);
@@ -65,13 +64,10 @@ const Post: React.FC<PostProps> = ({
     
     setLikeLoading(true);
     try {
-      const response = await fetch(`${BASE_URL}/api/posts/like`, {
+      const response = await authFetch('/api/posts/like', {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
-        body: JSON.stringify({ 
-          post_id: id,
-          username: user.username 
-        })
+        body: JSON.stringify({ post_id: id })
       });
       
       if (response.ok) {
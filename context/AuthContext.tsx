@@ -1,4 +1,5 @@
-import React, { createContext, useContext, useState, ReactNode } from "react";
+import React, { createContext, useContext, useState, useRef, useCallback, ReactNode } from "react";
+import { Platform } from "react-native";
 import { BASE_URL } from "@/constants/api";
 
 export type User = {
@@ -8,38 +9,146 @@ export type User = {
   profile_picture: string;
 };
 
+// Logging in with two-factor authentication on needs a code before a
+// session is started
+export type LoginResult =
+  | { twoFactorRequired: false }
+  | { twoFactorRequired: true; challengeToken: string };
+
+type Tokens = {
+  accessToken: string;
+  refreshToken: string;
+};
+
 type AuthContextType = {
   user: User | null;
-  login: (email: string, password: string) => Promise<void>;
-  register: (username: string, email: string, password: string) => Promise<void>;
+  login: (email: string, password: string) => Promise<LoginResult>;
+  verifyTwoFactor: (challengeToken: string, code: string) => Promise<void>;
+  register: (username: string, email: string, password: string) => Promise<string>;
   logout: () => void;
   updateUser: (updatedUser: User) => void;
+  // authFetch calls the API as the signed in user, refreshing the access
+  // token when it has expired
+  authFetch: (path: string, init?: RequestInit) => Promise<Response>;
 };
 
 const AuthContext = createContext<AuthContextType | undefined>(undefined);
 
 export const AuthProvider = ({ children }: { children: ReactNode }) => {
   const [user, setUser] = useState<User | null>(null);
+  // Tokens live in a ref so requests already in flight see a refreshed token
+  const tokens = useRef<Tokens | null>(null);
+  const refreshing = useRef<Promise<boolean> | null>(null);
+
+  const startSession = (data: any) => {
+    tokens.current = { accessToken: data.access_token, refreshToken: data.refresh_token };
+    setUser({
+      username: data.username,
+      email: data.email,
+      display_name: data.display_name,
+      profile_picture: data.profile_picture,
+    });
+  };
+
+  const logout = useCallback(() => {
+    tokens.current = null;
+    setUser(null);
+  }, []);
+
+  // refresh swaps the refresh token for new tokens, resolving to false if the
+  // session is no longer valid. Refresh tokens can only be used once, so
+  // requests that fail together share one refresh.
+  const refresh = useCallback(() => {
+    if (!refreshing.current) {
+      refreshing.current = (async () => {
+        const current = tokens.current;
+        if (!current) return false;
+
+        const response = await fetch(`${BASE_URL}/api/token/refresh`, {
+          method: "POST",
+          headers: { "Content-Type": "application/json" },
+          body: JSON.stringify({ refresh_token: current.refreshToken }),
+        });
+        if (response.status === 401) return false;
+        if (!response.ok) {
+          throw new Error("Token refresh failed");
+        }
+
+        const data = await response.json();
+        tokens.current = { accessToken: data.access_token, refreshToken: data.refresh_token };
+        return true;
+      })().finally(() => {
+        refreshing.current = null;
+      });
+    }
+    return refreshing.current;
+  }, []);
+
+  const authFetch = useCallback(
+    async (path: string, init: RequestInit = {}) => {
+      const send = () => {
+        const headers = new Headers(init.headers);
+        if (tokens.current) {
+          headers.set("Authorization", `Bearer ${tokens.current.accessToken}`);
+        }
+        return fetch(`${BASE_URL}${path}`, { ...init, headers });
+      };
+
+      let response = await send();
+      if (response.status === 401 && tokens.current) {
+        if (await refresh()) {
+          response = await send();
+        } else {
+          logout();
+        }
+      }
+      return response;
+    },
+    [refresh, logout]
+  );
 
-  const login = async (email: string, password: string) => {
+  const login = async (email: string, password: string): Promise<LoginResult> => {
     try {
       const response = await fetch(`${BASE_URL}/api/login`, {
         method: "POST",
         headers: { "Content-Type": "application/json" },
-        body: JSON.stringify({ email, password }),
+        body: JSON.stringify({ email, password, device_name: Platform.OS }),
       });
       if (!response.ok) {
-        throw new Error("Login failed");
+        throw new Error((await response.text()) || "Login failed");
       }
 
-      const userData: User = await response.json();
-      setUser(userData);
+      const data = await response.json();
+      if (data.two_factor_required) {
+        return { twoFactorRequired: true, challengeToken: data.challenge_token };
+      }
+      startSession(data);
+      return { twoFactorRequired: false };
     } catch (error) {
       console.error("Login error:", error);
       throw error;
     }
   };
 
+  const verifyTwoFactor = async (challengeToken: string, code: string) => {
+    try {
+      const response = await fetch(`${BASE_URL}/api/login/2fa`, {
+        method: "POST",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify({ challenge_token: challengeToken, code }),
+      });
+      if (!response.ok) {
+        throw new Error((await response.text()) || "Verification failed");
+      }
+      startSession(await response.json());
+    } catch (error) {
+      console.error("Two-factor error:", error);
+      throw error;
+    }
+  };
+
+  // New accounts have to verify their email before they can log in, so
+  // registering returns the server's message rather than signing in
   const register = async (username: string, email: string, password: string) => {
     try {
       const response = await fetch(`${BASE_URL}/api/register`, {
@@ -50,24 +159,22 @@ export const AuthProvider = ({ children }: { children: ReactNode }) => {
       if (!response.ok) {
         throw new Error("Registration failed");
       }
-      const userData: User = await response.json();
-      setUser(userData);
+      const data = await response.json();
+      return data.message as string;
     } catch (error) {
       console.error("Registration error:", error);
       throw error;
     }
   };
 
-  const logout = () => {
-    setUser(null);
-  };
-
   const updateUser = (updatedUser: User) => {
     setUser(updatedUser);
   };
 
   return (
-    <AuthContext.Provider value={{ user, login, register, logout, updateUser }}>
+    <AuthContext.Provider
+      value={{ user, login, verifyTwoFactor, register, logout, updateUser, authFetch }}
+    >
       {children}
     </AuthContext.Provider>
   );